@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xingbase/magicx/journal"
+)
+
+// FileName is the cache file written in the root folder, or in the user
+// cache directory when the root folder is read-only.
+const FileName = ".magicx-cache.json"
+
+// version is bumped when the entries change meaning, dropping older caches.
+const version = 3
+
+// Entry is the metadata of a file, valid while its size and modification
+// time are unchanged.
+type Entry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // Unix nanoseconds
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Format  string `json:"format"`
+	Color   string `json:"color"`
+	Depth   int    `json:"depth"`
+	Alpha   bool   `json:"alpha"`
+	Quality int    `json:"quality"`
+	PHash   uint64 `json:"phash,omitempty"`  // perceptual hash, valid when Hashed
+	Hashed  bool   `json:"hashed,omitempty"` // PHash is computed
+	Blank   bool   `json:"blank,omitempty"`  // near uniform page, without a meaningful PHash
+}
+
+type document struct {
+	Version int              `json:"version"`
+	Files   map[string]Entry `json:"files"`
+}
+
+// Cache is the file metadata of a root folder, keyed by "/" separated paths
+// relative to it. It is safe for concurrent use. A nil *Cache caches
+// nothing.
+type Cache struct {
+	mu      sync.Mutex
+	root    string
+	entries map[string]Entry
+	dirty   bool
+}
+
+// New returns an empty cache of the root folder, replacing the saved one on
+// Save.
+func New(root string) *Cache {
+	return &Cache{root: root, entries: make(map[string]Entry)}
+}
+
+// Open reads the cache of the root folder. A missing, unreadable or outdated
+// cache file gives an empty cache.
+func Open(root string) *Cache {
+	c := New(root)
+
+	for _, path := range c.paths() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var doc document
+		if err := json.Unmarshal(data, &doc); err != nil || doc.Version != version {
+			break
+		}
+		if doc.Files != nil {
+			c.entries = doc.Files
+		}
+		break
+	}
+
+	return c
+}
+
+// Get returns the entry of the file at rel when its size and modification
+// time are unchanged.
+func (c *Cache) Get(rel string, size int64, modTime time.Time) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[filepath.ToSlash(rel)]
+	if !ok || e.Size != size || e.ModTime != modTime.UnixNano() {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// Put stores the entry of the file at rel.
+func (c *Cache) Put(rel string, e Entry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[filepath.ToSlash(rel)] = e
+	c.dirty = true
+}
+
+// Retain drops the entries of the files not in rels, e.g. files renamed or
+// removed since the last scan.
+func (c *Cache) Retain(rels []string) {
+	if c == nil {
+		return
+	}
+
+	keep := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		keep[filepath.ToSlash(rel)] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for rel := range c.entries {
+		if !keep[rel] {
+			delete(c.entries, rel)
+			c.dirty = true
+		}
+	}
+}
+
+// Save writes the cache when it changed, in the root folder or, when that
+// fails, in the user cache directory.
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(document{Version: version, Files: c.entries})
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for _, path := range c.paths() {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = journal.WriteFile(path, data, 0644)
+		}
+		if err == nil {
+			c.dirty = false
+			return nil
+		}
+
+		if first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// paths returns the cache file of the root folder and the one of the user
+// cache directory, in order of preference.
+func (c *Cache) paths() []string {
+	paths := []string{filepath.Join(c.root, FileName)}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		root, err := filepath.Abs(c.root)
+		if err != nil {
+			root = c.root
+		}
+		sum := sha256.Sum256([]byte(root))
+		paths = append(paths, filepath.Join(dir, "magicx", hex.EncodeToString(sum[:8])+".json"))
+	}
+
+	return paths
+}
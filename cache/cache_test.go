@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetPutRetain(t *testing.T) {
+	root := t.TempDir()
+	modTime := time.Unix(1700000000, 0)
+
+	c := New(root)
+	c.Put("0001/abc_0001_001.jpg", Entry{Size: 10, ModTime: modTime.UnixNano(), Width: 690})
+	c.Put("0001/abc_0001_002.jpg", Entry{Size: 20, ModTime: modTime.UnixNano(), Width: 720})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = Open(root)
+	if e, ok := c.Get("0001/abc_0001_001.jpg", 10, modTime); !ok || e.Width != 690 {
+		t.Errorf("Get of an unchanged file = %+v, %v, want the saved entry", e, ok)
+	}
+	if _, ok := c.Get("0001/abc_0001_001.jpg", 10, modTime.Add(time.Second)); ok {
+		t.Error("Get of a file with a new modification time hit the cache")
+	}
+	if _, ok := c.Get("0001/abc_0001_001.jpg", 11, modTime); ok {
+		t.Error("Get of a file with a new size hit the cache")
+	}
+
+	c.Retain([]string{"0001/abc_0001_002.jpg"})
+	if _, ok := c.Get("0001/abc_0001_001.jpg", 10, modTime); ok {
+		t.Error("Get of a file dropped by Retain hit the cache")
+	}
+	if _, ok := c.Get("0001/abc_0001_002.jpg", 20, modTime); !ok {
+		t.Error("Get of a retained file missed the cache")
+	}
+}
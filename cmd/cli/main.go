@@ -1,29 +1,738 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
 
-	"github.com/xingbase/magicx/pipeline"
+	"github.com/xingbase/magicx"
+	"github.com/xingbase/magicx/cache"
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+	"github.com/xingbase/magicx/naming"
+	"github.com/xingbase/magicx/report"
+	"github.com/xingbase/magicx/resize"
 )
 
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// loadOptions configures the scans of every command.
+var loadOptions magicx.LoadOptions
+
+// rescan ignores the metadata cache of the series.
+var rescan bool
+
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitError    = 2
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) int
+}
+
+var commands = []command{
+	{name: "rename", description: "The rename command-line fix the numbering file.", run: runRename},
+	{name: "resize", description: "The resize command-line", run: runResize},
+	{name: "check", description: "The check command-line validates every episode of the series.", run: runCheck},
+	{name: "thumbnail", description: "The thumbnail command-line generates the missing episode thumbnails.", run: runThumbnail},
+	{name: "convert", description: "The convert command-line re-encodes the pages in a format not allowed or not matching their extension.", run: runConvert},
+	{name: "undo", description: "The undo command-line reverts the last rename, resize, thumbnail or convert run.", run: runUndo},
+}
+
 func main() {
-	dir := "/Users/JP17278/Downloads/7153"
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	var showVersion bool
+	config := magicx.DefaultProfilePath()
+
+	global := newFlagSet("magicx", "")
+	global.String(&config, "c", "config", config, "Profiles file (TOML)")
+	global.Int(&loadOptions.Concurrency, "j", "jobs", 0, "Files scanned in parallel, the number of CPUs when 0")
+	global.Bool(&rescan, "", "rescan", "Parse every file again instead of using the metadata cache")
+	global.Bool(&showVersion, "v", "version", "Show the version")
+	if err := global.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			usage(os.Stdout)
+			return exitOK
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	args = global.Args()
+
+	if showVersion {
+		fmt.Printf("magicx %s %s\n", version, commit)
+		return exitOK
+	}
+
+	if config != "" {
+		if err := magicx.UseProfiles(config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitError
+	}
+
+	switch args[0] {
+	case "help":
+		usage(os.Stdout)
+		return exitOK
+	case "version":
+		fmt.Printf("magicx %s %s\n", version, commit)
+		return exitOK
+	}
+
+	// Ctrl-C stops the command between two files, keeping the journal of
+	// the files already changed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command `%s'\n\n", args[0])
+	usage(os.Stderr)
+	return exitError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  magicx [OPTIONS] <command>")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Application Options:")
+	fmt.Fprintln(w, "  -c, --config=   Profiles file (TOML)")
+	fmt.Fprintln(w, "  -j, --jobs=     Files scanned in parallel, the number of CPUs when 0 (default: 0)")
+	fmt.Fprintln(w, "      --rescan    Parse every file again instead of using the metadata cache")
+	fmt.Fprintln(w, "  -v, --version   Show the version")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Help Options:")
+	fmt.Fprintln(w, "  -h, --help      Show this help message")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Available commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+}
+
+// option describes a flag registered with both a short and a long name.
+type option struct {
+	short, long string
+	usage       string
+	value       string
+	flag        bool // takes no value
+}
+
+// flagSet wraps flag.FlagSet to print help in the README format.
+type flagSet struct {
+	*flag.FlagSet
+	description string
+	options     []option
+}
+
+func newFlagSet(name, description string) *flagSet {
+	fs := &flagSet{
+		FlagSet:     flag.NewFlagSet(name, flag.ContinueOnError),
+		description: description,
+	}
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func (fs *flagSet) String(p *string, short, long, value, usage string) {
+	if short != "" {
+		fs.StringVar(p, short, value, usage)
+	}
+	fs.StringVar(p, long, value, usage)
+	fs.options = append(fs.options, option{short: short, long: long, usage: usage, value: value})
+}
+
+func (fs *flagSet) Int(p *int, short, long string, value int, usage string) {
+	if short != "" {
+		fs.IntVar(p, short, value, usage)
+	}
+	fs.IntVar(p, long, value, usage)
+	fs.options = append(fs.options, option{short: short, long: long, usage: usage, value: fmt.Sprint(value)})
+}
+
+func (fs *flagSet) Float(p *float64, short, long string, value float64, usage string) {
+	if short != "" {
+		fs.Float64Var(p, short, value, usage)
+	}
+	fs.Float64Var(p, long, value, usage)
+	fs.options = append(fs.options, option{short: short, long: long, usage: usage, value: fmt.Sprintf("%.1f", value)})
+}
+
+func (fs *flagSet) Bool(p *bool, short, long string, usage string) {
+	if short != "" {
+		fs.BoolVar(p, short, false, usage)
+	}
+	fs.BoolVar(p, long, false, usage)
+	fs.options = append(fs.options, option{short: short, long: long, usage: usage, flag: true})
+}
+
+func (fs *flagSet) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintf(w, "  magicx [OPTIONS] %s [%s-OPTIONS]\n", fs.Name(), fs.Name())
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, fs.description)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Help Options:")
+	fmt.Fprintln(w, "  -h, --help      Show this help message")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "[%s command options]\n", fs.Name())
 
-	limitInfo := pipeline.ContentTypeByLimitInfo["comic"]
+	names := make([]string, len(fs.options))
+	width := 0
+	for i, o := range fs.options {
+		if o.short != "" {
+			names[i] = fmt.Sprintf("-%s, --%s", o.short, o.long)
+		} else {
+			names[i] = fmt.Sprintf("    --%s", o.long)
+		}
+		if !o.flag {
+			names[i] += "="
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+
+	for i, o := range fs.options {
+		line := fmt.Sprintf("      %-*s %s", width, names[i], o.usage)
+		if o.value != "" {
+			line += fmt.Sprintf(" (default: %s)", o.value)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
 
-	images := pipeline.CheckImage(pipeline.Decode(pipeline.Rename(pipeline.Load(dir), 3)), limitInfo)
+// parse parses the command arguments. It returns false and the exit code
+// when the command must not run.
+func (fs *flagSet) parse(args []string) (bool, int) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		fs.usage(os.Stdout)
+		return false, exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr)
+		fs.usage(os.Stderr)
+		return false, exitError
+	}
+	return true, exitOK
+}
 
-	missmatchFolders := make(map[string]struct{})
-	for img := range images {
-		if !img.IsStandard {
-			fmt.Printf("%s width: %d, height: %d, size: %d\n", img.Name, img.Image.Bounds().Dx(), img.Image.Bounds().Dy(), img.Size)
+func requireDir(path string) bool {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "the required flag `-p, --path' was not specified")
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%s is not a directory\n", path)
+		return false
+	}
+	return true
+}
+
+func runRename(ctx context.Context, args []string) int {
+	var (
+		path     string
+		num      int
+		template string
+		series   string
+		dryRun   bool
+		yes      bool
+	)
+
+	fs := newFlagSet("rename", "The rename command-line fix the numbering file.")
+	fs.String(&path, "p", "path", "", "Full path")
+	fs.Int(&num, "n", "num", 3, "Suffix number")
+	fs.String(&template, "", "template", "", "Naming template, e.g. "+naming.DefaultTemplate)
+	fs.String(&series, "", "series", "", "Series name of the template, inferred when empty")
+	fs.Bool(&dryRun, "", "dry-run", "Show the renames without applying them")
+	fs.Bool(&yes, "y", "yes", "Apply the renames without asking")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+
+	var tmpl *naming.Template
+	if template != "" {
+		var err error
+		if tmpl, err = naming.Parse(template); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
 		}
-		if img.IsMissmatch {
-			missmatchFolders[img.Path] = struct{}{}
+	}
+
+	j := journal.Begin(path, "rename")
+	defer commitJournal(j)
+
+	scan := loadCache(path)
+	defer saveCache(scan)
+
+	progress := newProgressLine()
+
+	// the whole series is planned, and confirmed, at once
+	loaded, err := magicx.Load(ctx, path, scan, progress.report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	folderInfos := magicx.Collect(loaded)
+	if ctx.Err() != nil {
+		return interrupted(ctx, progress, exitError)
+	}
+	progress.clear()
+
+	plan := magicx.PlanRename(folderInfos, num)
+	if tmpl != nil {
+		if plan, err = magicx.PlanTemplateRename(folderInfos, tmpl, series); err != nil {
+			fmt.Fprintf(os.Stderr, "%v, give it with --series\n", err)
+			return exitError
 		}
 	}
+	if len(plan.Ops) == 0 {
+		fmt.Println("Nothing to rename")
+		return exitOK
+	}
+
+	fmt.Print(plan)
+
+	code := exitOK
+	collisions := len(plan.Collisions())
+	if collisions > 0 {
+		fmt.Fprintf(os.Stderr, "%d renames collide with existing files and will be skipped\n", collisions)
+		code = exitFindings
+	}
+
+	if dryRun || len(plan.Ops) == collisions {
+		return code
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Apply %d renames?", len(plan.Ops)-collisions)) {
+		fmt.Println("Aborted")
+		return code
+	}
+
+	renamed, err := plan.Apply(folderInfos, j)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = exitError
+	}
+	fmt.Printf("%d files renamed\n", renamed)
+
+	return code
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	var answer string
+	fmt.Scanln(&answer)
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func runResize(ctx context.Context, args []string) int {
+	var (
+		path    string
+		width   int
+		size    int
+		percent float64
+		dryRun  bool
+	)
+
+	fs := newFlagSet("resize", "The resize command-line")
+	fs.String(&path, "p", "path", "", "Full path")
+	fs.Int(&width, "w", "width", 2266, "Limit width")
+	fs.Int(&size, "s", "size", 30720, "Limit size (kb)")
+	fs.Float(&percent, "", "percent", 95.0, "Resize percentages")
+	fs.Bool(&dryRun, "", "dry-run", "List the pages to resize without writing them")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+
+	opts := resize.Options{
+		Width:   width,
+		Size:    int64(size) * 1024,
+		Percent: percent,
+	}
+
+	j := journal.Begin(path, "resize")
+	defer commitJournal(j)
+
+	scan := loadCache(path)
+	defer saveCache(scan)
+
+	progress := newProgressLine()
+
+	loaded, err := magicx.Load(ctx, path, scan, progress.report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for folder := range loaded {
+		for _, f := range folder.Files {
+			if ctx.Err() != nil {
+				break
+			}
+			if f.IsThumbnail || (f.Width <= opts.Width && f.Size <= opts.Size) {
+				continue
+			}
+
+			if dryRun {
+				progress.fprintf(os.Stdout, "%s width: %d, size: %s\n", f.FullName(), f.Width, file.FormatSize(f.Size))
+				code = exitFindings
+				continue
+			}
+
+			// the page is not compressed again above its own quality
+			fileOpts := opts
+			fileOpts.Quality = f.Quality
+
+			result, err := resize.File(f.FullName(), fileOpts, j)
+			if err != nil {
+				progress.fprintf(os.Stderr, "Failed to resize file %s: %v\n", f.Name, err)
+				code = exitError
+				continue
+			}
+
+			progress.fprintf(os.Stdout, "%s width: %d -> %d, size: %s -> %s%s\n", f.FullName(), f.Width, result.Width, file.FormatSize(f.Size), file.FormatSize(result.Size), qualityChange(f.Quality, result.Quality))
+		}
+	}
+
+	return interrupted(ctx, progress, code)
+}
+
+// qualityChange describes the JPEG quality of a page before and after it is
+// re-encoded, empty for other formats.
+func qualityChange(before, after int) string {
+	if after == 0 {
+		return ""
+	}
+	if before == 0 {
+		return fmt.Sprintf(", quality: %d", after)
+	}
+	return fmt.Sprintf(", quality: %d -> %d", before, after)
+}
+
+// formats are the report writers of the check command. The text format
+// is written by magicx.ConsoleLog.
+var formats = map[string]func(w io.Writer, r magicx.Report, lang magicx.Language) error{
+	"text": nil,
+	"json": report.JSON,
+	"csv":  report.CSV,
+	"html": report.HTML,
+}
+
+func runCheck(ctx context.Context, args []string) int {
+	var (
+		path        string
+		contentType string
+		lang        string
+		format      string
+	)
+
+	fs := newFlagSet("check", "The check command-line validates every episode of the series.")
+	fs.String(&path, "p", "path", "", "Full path")
+	fs.String(&contentType, "t", "type", "comic", fmt.Sprintf("Content type (%s)", strings.Join(magicx.ContentTypes(), ", ")))
+	fs.String(&lang, "l", "lang", "jp", "Language of the results (en, jp)")
+	fs.String(&format, "f", "format", "text", "Output format (text, json, csv, html)")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+	write, ok := formats[format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+		return exitError
+	}
+
+	limited, ok := magicx.LimitedSizeInfoByContentType[contentType]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown content type %q\n", contentType)
+		return exitError
+	}
+
+	language := magicx.JP
+	if lang == "en" {
+		language = magicx.EN
+	}
+
+	scan := loadCache(path)
+	scan.PerceptualHash = limited.UsesPerceptualHash()
+	defer saveCache(scan)
+
+	progress := newProgressLine()
+
+	result := magicx.Report{}
+	loaded, err := magicx.Load(ctx, path, scan, progress.report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	for episode := range magicx.Check(ctx, loaded, limited, nil) {
+		result.Add(episode)
+	}
+	progress.clear()
+
+	if ctx.Err() != nil {
+		return interrupted(ctx, progress, exitError)
+	}
+
+	if write != nil {
+		if err := write(os.Stdout, result, language); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	} else {
+		fmt.Print(magicx.ConsoleLog(result, language, limited.EnabledRules()...))
+	}
+
+	if result.HasFindings(limited.EnabledRules()...) {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func runThumbnail(ctx context.Context, args []string) int {
+	var (
+		path        string
+		contentType string
+		page        int
+		height      int
+	)
+
+	fs := newFlagSet("thumbnail", "The thumbnail command-line generates the missing episode thumbnails.")
+	fs.String(&path, "p", "path", "", "Full path")
+	fs.String(&contentType, "t", "type", "comic", fmt.Sprintf("Content type (%s)", strings.Join(magicx.ContentTypes(), ", ")))
+	fs.Int(&page, "", "page", 0, "Page number used as the thumbnail, first page when 0")
+	fs.Int(&height, "", "height", 0, "Crop height, keeps the aspect ratio when 0")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+
+	limited, ok := magicx.LimitedSizeInfoByContentType[contentType]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown content type %q\n", contentType)
+		return exitError
+	}
+
+	opts := magicx.ThumbnailOptions{Page: page, Height: height}
+
+	j := journal.Begin(path, "thumbnail")
+	defer commitJournal(j)
+
+	scan := loadCache(path)
+	defer saveCache(scan)
+
+	progress := newProgressLine()
+
+	loaded, err := magicx.Load(ctx, path, scan, progress.report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for folder := range loaded {
+		if ctx.Err() != nil {
+			break
+		}
+		if n, _ := file.ExtractFolderNum(folder.Name); n == 0 || magicx.HasThumbnail(folder) {
+			continue
+		}
+
+		thumb, err := magicx.Thumbnail(folder, limited, opts, j)
+		if err != nil {
+			progress.fprintf(os.Stderr, "Failed to generate thumbnail %s: %v\n", folder.Name, err)
+			code = exitError
+			continue
+		}
+
+		progress.fprintf(os.Stdout, "%s width: %d, size: %s\n", thumb.FullName(), thumb.Width, file.FormatSize(thumb.Size))
+	}
+
+	return interrupted(ctx, progress, code)
+}
+
+func runConvert(ctx context.Context, args []string) int {
+	var (
+		path        string
+		contentType string
+		dryRun      bool
+		convert     magicx.ConvertOptions
+	)
+
+	fs := newFlagSet("convert", "The convert command-line re-encodes the pages in a format not allowed or not matching their extension.")
+	fs.String(&path, "p", "path", "", "Full path")
+	fs.String(&contentType, "t", "type", "comic", fmt.Sprintf("Content type (%s)", strings.Join(magicx.ContentTypes(), ", ")))
+	fs.Bool(&convert.RGB, "", "rgb", "Also convert CMYK, YCCK, 16-bit and transparent pages to 8-bit RGB")
+	fs.Bool(&dryRun, "", "dry-run", "List the pages to convert without writing them")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+
+	limited, ok := magicx.LimitedSizeInfoByContentType[contentType]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown content type %q\n", contentType)
+		return exitError
+	}
+
+	j := journal.Begin(path, "convert")
+	defer commitJournal(j)
+
+	scan := loadCache(path)
+	defer saveCache(scan)
+
+	progress := newProgressLine()
+
+	loaded, err := magicx.Load(ctx, path, scan, progress.report)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for folder := range loaded {
+		for _, f := range folder.Files {
+			if ctx.Err() != nil {
+				break
+			}
+
+			format, name, ok := magicx.ConvertTarget(f, limited, convert)
+			if !ok {
+				continue
+			}
+
+			if dryRun {
+				progress.fprintf(os.Stdout, "%s/%s (%s, %s) -> %s (%s)\n", folder.Name, f.Name, f.Format, f.ColorMode(), name, format)
+				code = exitFindings
+				continue
+			}
+
+			converted, err := magicx.Convert(f, limited, convert, j)
+			if err != nil {
+				progress.fprintf(os.Stderr, "Failed to convert file %s: %v\n", f.Name, err)
+				code = exitError
+				continue
+			}
+
+			progress.fprintf(os.Stdout, "%s/%s (%s, %s) -> %s (%s, %s), size: %s -> %s\n", folder.Name, f.Name, f.Format, f.ColorMode(), converted.Name, converted.Format, converted.ColorMode(), file.FormatSize(f.Size), file.FormatSize(converted.Size))
+		}
+	}
+
+	return interrupted(ctx, progress, code)
+}
+
+func runUndo(ctx context.Context, args []string) int {
+	var path string
+
+	fs := newFlagSet("undo", "The undo command-line reverts the last rename, resize, thumbnail or convert run.")
+	fs.String(&path, "p", "path", "", "Full path")
+
+	if ok, code := fs.parse(args); !ok {
+		return code
+	}
+	if !requireDir(path) {
+		return exitError
+	}
+
+	run, err := journal.Undo(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	fmt.Printf("Reverted %s run of %s (%d operations)\n", run.Command, run.Time.Format("2006-01-02 15:04:05"), len(run.Entries))
+	return exitOK
+}
+
+// interrupted returns the exit code of a command, exitError when it was
+// interrupted.
+func interrupted(ctx context.Context, progress *progressLine, code int) int {
+	progress.clear()
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		return exitError
+	}
+	return code
+}
+
+// loadCache returns the scan options of the series with its metadata cache,
+// empty with --rescan.
+func loadCache(path string) magicx.LoadOptions {
+	opts := loadOptions
+	if rescan {
+		opts.Cache = cache.New(path)
+	} else {
+		opts.Cache = cache.Open(path)
+	}
+	return opts
+}
+
+// saveCache writes the metadata cache of the series, reporting failures on
+// stderr.
+func saveCache(opts magicx.LoadOptions) {
+	if err := opts.Cache.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write cache:", err)
+	}
+}
 
-	for folder := range missmatchFolders {
-		fmt.Printf("Missmatch: %s \n", folder)
+// commitJournal writes the journal of the run, reporting failures on stderr.
+func commitJournal(j *journal.Journal) {
+	if err := j.Commit(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write journal:", err)
 	}
 }
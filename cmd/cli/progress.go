@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xingbase/magicx"
+)
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progressLine draws the progress of the pipeline on a single line of
+// stderr. Output written while the pipeline runs goes through fprintf so it
+// does not mix with the line. A nil *progressLine draws nothing.
+type progressLine struct {
+	mu    sync.Mutex
+	last  time.Time
+	shown bool
+}
+
+// newProgressLine returns a progress line, or nil when stderr is not a
+// terminal so redirected output stays clean.
+func newProgressLine() *progressLine {
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return &progressLine{}
+}
+
+func (l *progressLine) report(p magicx.Progress) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if p.Done != p.Total && time.Since(l.last) < progressInterval {
+		return
+	}
+	l.last = time.Now()
+	l.shown = true
+
+	if p.Total > 0 {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s %d/%d %s", p.Stage, p.Done, p.Total, p.Episode)
+	} else {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s %d %s", p.Stage, p.Done, p.Episode)
+	}
+}
+
+// fprintf erases the progress line and writes the output. The line is drawn
+// again on the next progress.
+func (l *progressLine) fprintf(w io.Writer, format string, a ...interface{}) {
+	if l != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.erase()
+	}
+
+	fmt.Fprintf(w, format, a...)
+}
+
+// clear erases the progress line before other output is written.
+func (l *progressLine) clear() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.erase()
+}
+
+func (l *progressLine) erase() {
+	if !l.shown {
+		return
+	}
+	l.shown = false
+
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
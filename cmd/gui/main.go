@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -9,29 +11,99 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"github.com/xingbase/magicx"
-	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/cache"
+	"github.com/xingbase/magicx/journal"
+	"github.com/xingbase/magicx/report"
 )
 
 func main() {
 	myApp := app.New()
 	myWindow := myApp.NewWindow("MagicX v1.4.4")
 
+	// checks do not run with the built-in limits when the profiles are invalid
+	var profileErr error
+	if config := magicx.DefaultProfilePath(); config != "" {
+		if err := magicx.UseProfiles(config); err != nil {
+			profileErr = fmt.Errorf("failed to load profiles, fix the file and restart: %w", err)
+		}
+	}
+
 	folderPathEntry := widget.NewEntry()
 	folderPathEntry.SetPlaceHolder("Enter folder path")
 
-	contentTypeSelect := widget.NewSelect([]string{"comic", "magazine_comic"}, func(value string) {
+	contentTypeSelect := widget.NewSelect(magicx.ContentTypes(), func(value string) {
 		fmt.Println("Content type selected:", value)
 	})
 	contentTypeSelect.SetSelected("comic")
 
 	progress := widget.NewProgressBar()
 	progress.Hide()
+	progressLabel := widget.NewLabel("")
+	progressLabel.Hide()
+
+	var cancelRun context.CancelFunc
+	cancelButton := widget.NewButton("Cancel", func() {
+		if cancelRun != nil {
+			cancelRun()
+		}
+	})
+	cancelButton.Disable()
 
 	resultTextArea := widget.NewMultiLineEntry()
 
 	resultScroll := container.NewScroll(resultTextArea)
 	resultScroll.SetMinSize(fyne.NewSize(800, 600))
 
+	var lastReport magicx.Report
+
+	export := func(write func(w io.Writer, r magicx.Report, lang magicx.Language) error) func() {
+		return func() {
+			dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil {
+					dialog.ShowError(err, myWindow)
+					return
+				}
+				if writer == nil {
+					return
+				}
+				defer writer.Close()
+
+				if err := write(writer, lastReport, magicx.JP); err != nil {
+					dialog.ShowError(err, myWindow)
+				}
+			}, myWindow)
+		}
+	}
+
+	exportButton := widget.NewButton("Export JSON", export(report.JSON))
+	exportCSVButton := widget.NewButton("Export CSV", export(report.CSV))
+	exportHTMLButton := widget.NewButton("Export HTML", export(report.HTML))
+	exportButton.Disable()
+	exportCSVButton.Disable()
+	exportHTMLButton.Disable()
+
+	undoButton := widget.NewButton("Undo", func() {
+		folderPath := folderPathEntry.Text
+		if folderPath == "" {
+			dialog.ShowInformation("Error", "Please enter a folder path", myWindow)
+			return
+		}
+
+		dialog.ShowConfirm("Undo", "Revert the last run on this folder?", func(ok bool) {
+			if !ok {
+				return
+			}
+
+			run, err := journal.Undo(folderPath)
+			if err != nil {
+				dialog.ShowError(err, myWindow)
+				return
+			}
+
+			dialog.ShowInformation("Undo", fmt.Sprintf("Reverted %s run of %s (%d operations).", run.Command, run.Time.Format("2006-01-02 15:04:05"), len(run.Entries)), myWindow)
+		}, myWindow)
+	})
+
 	var runButton *widget.Button
 	runButton = widget.NewButton("Run", func() {
 		folderPath := folderPathEntry.Text
@@ -40,112 +112,102 @@ func main() {
 			dialog.ShowInformation("Error", "Please enter a folder path", myWindow)
 			return
 		}
+		if profileErr != nil {
+			dialog.ShowError(profileErr, myWindow)
+			return
+		}
 
 		fmt.Printf("Processing folder: %s as %s\n", folderPath, contentType)
 
 		runButton.Disable()
+		exportButton.Disable()
+		exportCSVButton.Disable()
+		exportHTMLButton.Disable()
 		resultTextArea.SetText("") // Clear previous results
 
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelRun = cancel
+		cancelButton.Enable()
+
+		progress.SetValue(0)
+		progress.Show()
+		progressLabel.SetText("")
+		progressLabel.Show()
+
+		onProgress := func(p magicx.Progress) {
+			if p.Total > 0 {
+				progress.SetValue(float64(p.Done) / float64(p.Total))
+			}
+			progressLabel.SetText(fmt.Sprintf("%s %d/%d %s", p.Stage, p.Done, p.Total, p.Episode))
+		}
+
 		go func() {
-			output := magicx.Reanme(magicx.Load(folderPath))
+			defer cancel()
 
 			limited := magicx.LimitedSizeInfoByContentType[contentType]
 
-			folders := make(map[string]struct{}, 0)
-			images := make(map[string]struct{}, 0)
-			sizeOver := make(map[string]struct{}, 0)
-			thumbs := make(map[string]struct{}, 0)
-			mismatch := make(map[string]struct{}, 0)
-			notFoundThumbs := make(map[string]struct{}, 0)
-			notFoundImages := make(map[string]struct{}, 0)
-			noNumberings := make(map[string]struct{}, 0)
-
-			for folderInfos := range output {
-				for i := range folderInfos {
-					n, _ := file.ExtractFolderNum(folderInfos[i].Name)
-					if n == 0 {
-						continue
-					}
-
-					episodeName := magicx.EpisodeName(n, magicx.JP)
-
-					notFoundThumbs[episodeName] = struct{}{}
-
-					if folderInfos[i].Size > limited.Folder {
-						folders[episodeName] = struct{}{}
-					}
-
-					groupedImages := make(map[int][]magicx.FileInfo)
-					widthCounts := make(map[int]int)
-					maxCount := 0
-					standardWidth := 0
-
-					imageFileNums := []int{}
-
-					for _, f := range folderInfos[i].Files {
-						if f.IsMissmatch {
-							mismatch[episodeName] = struct{}{}
-						}
-
-						if f.IsThumbnail {
-							thumbN, _ := file.ExtractFolderNum(f.Name)
-
-							if f.Size > limited.Thumbnail.Size {
-								thumbs[episodeName] = struct{}{}
-							}
-
-							if thumbN == n {
-								delete(notFoundThumbs, episodeName)
-							}
-
-						} else {
-							// First pass: Group images by width and find the most common width
-							width := f.Width
-							groupedImages[width] = append(groupedImages[width], f)
-							widthCounts[width]++
-
-							if widthCounts[width] > maxCount {
-								maxCount = widthCounts[width]
-								standardWidth = width
-							}
-
-							fileN, _ := file.ExtractFileExtNum(f.Name, f.Ext)
-							imageFileNums = append(imageFileNums, fileN)
-						}
-					}
-
-					if !file.IsConsecutive(imageFileNums) {
-						noNumberings[episodeName] = struct{}{}
-					}
-
-					if len(imageFileNums) == 0 {
-						notFoundImages[episodeName] = struct{}{}
-					}
-
-					// Second pass: Process grouped images and determine if they are standard
-					for width, imgs := range groupedImages {
-						isStandardWidth := (width == standardWidth)
-						for _, img := range imgs {
-							processedImg := img
-							processedImg.IsStandard = isStandardWidth
-
-							// Check size against limit
-							if img.Size > limited.Image.Size {
-								sizeOver[episodeName] = struct{}{}
-							}
-
-							if !processedImg.IsStandard {
-								images[episodeName] = struct{}{}
-							}
-						}
-					}
+			// show the results of every episode as soon as it is scanned
+			scan := magicx.LoadOptions{Cache: cache.Open(folderPath), PerceptualHash: limited.UsesPerceptualHash()}
+			validator := magicx.NewValidator(limited)
+
+			loaded, err := magicx.Load(ctx, folderPath, scan, onProgress)
+			if err != nil {
+				cancelButton.Disable()
+				progress.Hide()
+				progressLabel.Hide()
+				dialog.ShowError(err, myWindow)
+				runButton.Enable()
+				return
+			}
+
+			result := magicx.Report{}
+			folderInfos := make([]magicx.FolderInfo, 0)
+			for folderInfo := range loaded {
+				folderInfos = append(folderInfos, folderInfo)
+
+				if episode, ok := validator.Validate(folderInfo); ok {
+					result.Add(episode)
 				}
+				resultTextArea.SetText(magicx.ConsoleLog(result, magicx.JP, limited.EnabledRules()...))
+			}
+
+			cancelButton.Disable()
+			progress.Hide()
+			progressLabel.Hide()
+
+			if err := scan.Cache.Save(); err != nil {
+				dialog.ShowError(fmt.Errorf("failed to write cache: %w", err), myWindow)
+			}
+
+			if ctx.Err() != nil {
+				dialog.ShowInformation("Cancelled", "MagicX processing has been cancelled.", myWindow)
+				runButton.Enable()
+				return
 			}
 
+			// the renames are planned on the whole series and confirmed once
+			plan := magicx.PlanRename(folderInfos, 3)
+			if len(plan.Ops) > 0 && confirmRename(plan, myWindow) {
+				j := journal.Begin(folderPath, "rename")
+				if _, err := plan.Apply(folderInfos, j); err != nil {
+					dialog.ShowError(err, myWindow)
+				}
+				if err := j.Commit(); err != nil {
+					dialog.ShowError(err, myWindow)
+				}
+
+				result = magicx.Validate(folderInfos, limited)
+			}
+
+			lastReport = result
+
 			myWindow.Canvas().Content().Refresh()
-			resultTextArea.SetText(magicx.ConsoleLog(folders, images, sizeOver, thumbs, mismatch, notFoundThumbs, notFoundImages, noNumberings)) // Set the results in the textarea
+			resultTextArea.SetText(magicx.ConsoleLog(result, magicx.JP, limited.EnabledRules()...)) // Set the results in the textarea
 			dialog.ShowInformation("Complete", "MagicX processing has been completed.", myWindow)
 			runButton.Enable()
+			exportButton.Enable()
+			exportCSVButton.Enable()
+			exportHTMLButton.Enable()
 
 			myApp.SendNotification(&fyne.Notification{
 				Title:   "Process Complete",
@@ -159,12 +221,40 @@ func main() {
 		folderPathEntry,
 		widget.NewLabel("Content Type:"),
 		contentTypeSelect,
-		runButton,
+		container.NewHBox(runButton, cancelButton, undoButton, exportButton, exportCSVButton, exportHTMLButton),
+		progress,
+		progressLabel,
 		widget.NewLabel("Results:"),
 		resultScroll,
 	)
 
 	myWindow.SetContent(content)
 	myWindow.Resize(fyne.NewSize(800, 600))
+	if profileErr != nil {
+		dialog.ShowError(profileErr, myWindow)
+	}
 	myWindow.ShowAndRun()
 }
+
+// confirmRename shows the rename plan and blocks until the user applies or
+// skips it.
+func confirmRename(plan magicx.RenamePlan, window fyne.Window) bool {
+	planText := widget.NewMultiLineEntry()
+	planText.SetText(plan.String())
+	planText.Wrapping = fyne.TextWrapOff
+
+	planScroll := container.NewScroll(planText)
+	planScroll.SetMinSize(fyne.NewSize(700, 400))
+
+	message := fmt.Sprintf("%d files will be renamed.", len(plan.Ops)-len(plan.Collisions()))
+	if collisions := len(plan.Collisions()); collisions > 0 {
+		message += fmt.Sprintf(" %d renames collide with existing files and will be skipped.", collisions)
+	}
+
+	answer := make(chan bool, 1)
+	dialog.ShowCustomConfirm("Rename plan", "Apply", "Skip", container.NewBorder(widget.NewLabel(message), nil, nil, nil, planScroll), func(apply bool) {
+		answer <- apply
+	}, window)
+
+	return <-answer
+}
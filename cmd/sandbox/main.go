@@ -1,121 +1,40 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	_ "image/gif"  //   Import GIF decoder
 	_ "image/jpeg" // Import JPEG decoder
 	_ "image/png"  // Import PNG decoder
 
 	"github.com/xingbase/magicx"
-	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
 )
 
 func main() {
 	dir := "/Users/JP17278/Downloads/data"
 
-	result := magicx.Reanme(magicx.Load(dir))
-
 	limited := magicx.LimitedSizeInfoByContentType["comic"]
+	limited.Rules = magicx.RegisteredRules()
 
-	underImages := make(map[string]struct{}, 0)
-	underThumbs := make(map[string]struct{}, 0)
-	folders := make(map[string]struct{}, 0)
-	images := make(map[string]struct{}, 0)
-	thumbs := make(map[string]struct{}, 0)
-	mismatch := make(map[string]struct{}, 0)
-	notFoundThumbs := make(map[string]struct{}, 0)
-	notNumberings := make(map[string]struct{}, 0)
-	notFoundImages := make(map[string]struct{}, 0)
-
-	for folderInfos := range result {
-		for i := range folderInfos {
-			n, _ := file.ExtractFolderNum(folderInfos[i].Name)
-			if n == 0 {
-				continue
-			}
-
-			episodeName := magicx.EpisodeName(n, magicx.JP)
-
-			notFoundThumbs[episodeName] = struct{}{}
-
-			if folderInfos[i].Size > limited.Folder {
-				folders[episodeName] = struct{}{}
-			}
-
-			groupedImages := make(map[int][]magicx.FileInfo)
-			widthCounts := make(map[int]int)
-			maxCount := 0
-			standardWidth := 0
-
-			imageFileNums := []int{}
-
-			for _, f := range folderInfos[i].Files {
-				if f.IsMissmatch {
-					mismatch[episodeName] = struct{}{}
-				}
+	j := journal.Begin(dir, "sandbox")
 
-				if f.IsThumbnail {
-					if f.Size > limited.Thumbnail.Size {
-						thumbs[episodeName] = struct{}{}
-					}
-					if f.Size < magicx.UnderImageSize {
-						underThumbs[episodeName] = struct{}{}
-					}
+	ctx := context.Background()
 
-					delete(notFoundThumbs, episodeName)
-				} else {
-					width := f.Width
-					groupedImages[width] = append(groupedImages[width], f)
-					widthCounts[width]++
-
-					if widthCounts[width] > maxCount {
-						maxCount = widthCounts[width]
-						standardWidth = width
-					}
-
-					fileN, _ := file.ExtractFileNum(f.Name)
-					imageFileNums = append(imageFileNums, fileN)
-				}
-			}
-
-			if !file.IsConsecutive(imageFileNums) {
-				notNumberings[episodeName] = struct{}{}
-			}
-
-			if len(imageFileNums) == 0 {
-				notFoundImages[episodeName] = struct{}{}
-			}
-
-			// Second pass: Process grouped images and determine if they are standard
-			for width, imgs := range groupedImages {
-				isStandardWidth := (width == standardWidth)
-				for _, img := range imgs {
-					processedImg := img
-					processedImg.IsStandard = isStandardWidth
-
-					// Check size against limit
-					if img.Size > limited.Image.Size {
-						processedImg.IsStandard = false
-					}
-					if img.Size < magicx.UnderImageSize {
-						underImages[episodeName] = struct{}{}
-					}
+	loaded, err := magicx.Load(ctx, dir, magicx.LoadOptions{PerceptualHash: limited.UsesPerceptualHash()}, nil)
+	if err != nil {
+		fmt.Println("Failed to read series:", err)
+		return
+	}
 
-					if !processedImg.IsStandard {
-						images[episodeName] = struct{}{}
-					}
-				}
-			}
-		}
+	report := magicx.Report{}
+	for episode := range magicx.Check(ctx, magicx.Reanme(ctx, loaded, 3, j, nil), limited, nil) {
+		report.Add(episode)
 	}
 
-	magicx.Println("1話の容量が60MBを超えていた話", folders)
-	magicx.Println("1話内で横幅が統一されていない話", images)
-	magicx.Println("話サムネの容量が50KB以上になっていた話", thumbs)
-	magicx.Println("1話の容量が5KB以下になっていた話", underImages)
-	magicx.Println("話サムネの容量が5KB以下になっていた話", underThumbs)
-	magicx.Println("フォルダ名とファイル名一致していない話", mismatch)
-	magicx.Println("サムネがない話", notFoundThumbs)
-	magicx.Println("イメージがない話", notFoundImages)
-	magicx.Println("ページ表記が順番になってない話", notNumberings)
+	if err := j.Commit(); err != nil {
+		fmt.Println("Failed to write journal:", err)
+	}
 
+	fmt.Print(magicx.ConsoleLog(report, magicx.JP, limited.EnabledRules()...))
 }
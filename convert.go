@@ -0,0 +1,187 @@
+package magicx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+	"github.com/xingbase/magicx/resize"
+)
+
+// ConvertOptions configures Convert.
+type ConvertOptions struct {
+	RGB bool // also convert CMYK, YCCK, 16-bit and transparent pages to 8-bit RGB, or 8-bit gray for grayscale pages
+}
+
+// rgb reports whether the page is converted to 8-bit RGB, or 8-bit
+// grayscale when it is grayscale.
+func (o ConvertOptions) rgb(f FileInfo) bool {
+	return o.RGB && (f.Color == file.ColorCMYK || f.Color == file.ColorYCCK || f.Depth > 8 || f.Alpha)
+}
+
+// ConvertTarget returns the format and file name the page must be converted
+// to, or false when its format is allowed and matches its extension and,
+// with opts.RGB, it is already 8-bit RGB or grayscale. Pages keep their
+// format when it is allowed, taking its extension, so a PNG saved as .jpg is
+// renamed rather than re-encoded as JPEG. Otherwise they take the format of
+// their extension when it is allowed, keeping their name, or else the first
+// allowed format the encoder writes, PNG when any is allowed, and its
+// extension.
+func ConvertTarget(f FileInfo, limited LimitedSizeInfo, opts ConvertOptions) (string, string, bool) {
+	if f.Format == "" {
+		return "", "", false
+	}
+
+	rgb := opts.rgb(f)
+	extFormat := file.ExtensionFormat(f.Ext)
+	if extFormat == f.Format && limited.AllowsFormat(f.Format) && !rgb {
+		return "", "", false
+	}
+
+	// pages keep their format unless they are re-encoded
+	writes := func(format string) bool {
+		return limited.AllowsFormat(format) && ((format == f.Format && !rgb) || resize.CanEncode(format))
+	}
+
+	candidates := limited.Formats
+	if len(candidates) == 0 {
+		candidates = []string{"png"}
+	}
+
+	format := ""
+	switch {
+	case writes(f.Format):
+		format = f.Format
+	case extFormat != "" && writes(extFormat):
+		format = extFormat
+	default:
+		for _, allowed := range candidates {
+			if writes(allowed) {
+				format = allowed
+				break
+			}
+		}
+	}
+	if format == "" {
+		return "", "", false
+	}
+
+	name := f.Name
+	if format != extFormat {
+		name = strings.TrimSuffix(f.Name, filepath.Ext(f.Name)) + file.FormatExtensions[format][0]
+	}
+	return format, name, true
+}
+
+// Convert writes the page in the target format of ConvertTarget through the
+// journal and returns the converted file. Pages only needing their extension
+// fixed are renamed, others are re-encoded; the original is removed when the
+// name changes.
+func Convert(f FileInfo, limited LimitedSizeInfo, opts ConvertOptions, j *journal.Journal) (FileInfo, error) {
+	format, name, ok := ConvertTarget(f, limited, opts)
+	if !ok {
+		return f, nil
+	}
+
+	converted := f
+	converted.Name = name
+	converted.Ext = strings.ToLower(filepath.Ext(name))
+	converted.Format = format
+	converted.ModTime = time.Now()
+
+	if name != f.Name {
+		if _, err := os.Stat(converted.FullName()); err == nil {
+			return f, fmt.Errorf("%s already exists", name)
+		}
+	}
+
+	if format == f.Format && !opts.rgb(f) {
+		if err := j.Rename(f.FullName(), converted.FullName()); err != nil {
+			return f, err
+		}
+		return converted, nil
+	}
+
+	img, _, err := resize.Decode(f.FullName())
+	if err != nil {
+		return f, err
+	}
+	if opts.rgb(f) {
+		// grayscale pages stay grayscale, only their depth changes
+		if f.Color == file.ColorGray {
+			img = resize.ToGray(img)
+		} else {
+			img = resize.ToRGB(img)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := resize.Encode(&buf, img, format, resize.StartQuality(f.Quality)); err != nil {
+		return f, err
+	}
+	converted.Size = int64(buf.Len())
+	if written, err := file.ParseImageBytes(buf.Bytes()); err == nil {
+		converted.setImage(written)
+	}
+
+	if name == f.Name {
+		if err := j.Replace(f.FullName(), buf.Bytes(), 0644); err != nil {
+			return f, err
+		}
+		return converted, nil
+	}
+
+	if err := j.Create(converted.FullName(), buf.Bytes(), 0644); err != nil {
+		return f, err
+	}
+	if err := j.Delete(f.FullName()); err != nil {
+		return converted, err
+	}
+	return converted, nil
+}
+
+// Converts is the conversion stage of the pipeline, converting the pages in
+// a format not allowed by the content type or not matching their extension,
+// and with opts.RGB the pages not in 8-bit RGB. Failed conversions are added
+// to the folder errors. It stops when ctx is cancelled.
+func Converts(ctx context.Context, in <-chan FolderInfo, limited LimitedSizeInfo, opts ConvertOptions, j *journal.Journal, progress ProgressFunc) <-chan FolderInfo {
+	out := make(chan FolderInfo)
+
+	go func() {
+		defer close(out)
+
+		done := 0
+		for folderInfo := range in {
+			for i, f := range folderInfo.Files {
+				if ctx.Err() != nil {
+					return
+				}
+
+				done++
+				progress.report(Progress{Stage: StageConvert, Done: done, Episode: folderInfo.Name})
+
+				converted, err := Convert(f, limited, opts, j)
+				if err != nil {
+					folderInfo.Errors = append(folderInfo.Errors, FileError{File: f, Op: OpWrite, Err: err})
+				}
+
+				folderInfo.Size += converted.Size - f.Size
+				folderInfo.Files[i] = converted
+			}
+
+			select {
+			case out <- folderInfo:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
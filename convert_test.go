@@ -0,0 +1,83 @@
+package magicx
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+)
+
+func TestConvertTarget(t *testing.T) {
+	page := func(name, format string) FileInfo {
+		return FileInfo{Name: name, Ext: filepath.Ext(name), Format: format, Color: file.ColorRGB, Depth: 8}
+	}
+	cmyk := page("abc_0001_001.jpg", "jpeg")
+	cmyk.Color = file.ColorCMYK
+
+	tests := []struct {
+		f          FileInfo
+		formats    []string
+		opts       ConvertOptions
+		wantFormat string
+		wantName   string
+		wantOK     bool
+	}{
+		{page("abc_0001_001.jpg", "jpeg"), nil, ConvertOptions{}, "", "", false},
+		{page("abc_0001_001.jpg", "png"), nil, ConvertOptions{}, "png", "abc_0001_001.png", true},
+		{page("abc_0001_001.jpg", "png"), []string{"jpeg", "png"}, ConvertOptions{}, "png", "abc_0001_001.png", true},
+		{page("abc_0001_001.jpg", "png"), []string{"jpeg"}, ConvertOptions{}, "jpeg", "abc_0001_001.jpg", true},
+		{page("abc_0001_001.png", "png"), []string{"jpeg"}, ConvertOptions{}, "jpeg", "abc_0001_001.jpg", true},
+		{page("abc_0001_001.webp", "webp"), []string{"jpeg", "png"}, ConvertOptions{}, "jpeg", "abc_0001_001.jpg", true},
+		{page("abc_0001_001.jpeg", "jpeg"), nil, ConvertOptions{}, "", "", false},
+		{cmyk, nil, ConvertOptions{}, "", "", false},
+		{cmyk, nil, ConvertOptions{RGB: true}, "jpeg", "abc_0001_001.jpg", true},
+		{page("abc_0001_001.gif", "gif"), []string{"webp"}, ConvertOptions{}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		format, name, ok := ConvertTarget(tt.f, LimitedSizeInfo{Formats: tt.formats}, tt.opts)
+		if format != tt.wantFormat || name != tt.wantName || ok != tt.wantOK {
+			t.Errorf("ConvertTarget(%s as %s, %v, %+v) = %q, %q, %v, want %q, %q, %v",
+				tt.f.Name, tt.f.Format, tt.formats, tt.opts, format, name, ok, tt.wantFormat, tt.wantName, tt.wantOK)
+		}
+	}
+}
+
+func TestConvertRGBKeepsGrayscale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0001", "abc_0001_001.png")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(out, image.NewGray16(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	loaded, err := Load(context.Background(), dir, LoadOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders := Collect(loaded)
+	if len(folders) != 1 || len(folders[0].Files) != 1 {
+		t.Fatalf("got %+v, want one folder with one page", folders)
+	}
+	f := folders[0].Files[0]
+
+	converted, err := Convert(f, LimitedSizeInfo{}, ConvertOptions{RGB: true}, journal.Begin(dir, "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.Color != file.ColorGray || converted.Depth != 8 {
+		t.Errorf("converted 16-bit grayscale page = %s %d-bit, want gray 8-bit", converted.Color, converted.Depth)
+	}
+}
@@ -0,0 +1,164 @@
+package magicx
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/resize"
+)
+
+// DefaultDecodeBudget is the memory, in bytes, of the images decoded at once
+// by the Decode stage when DecodeOptions.Budget is 0.
+const DefaultDecodeBudget int64 = 512 << 20 // 512MB
+
+// DecodeOptions configures Decode.
+type DecodeOptions struct {
+	Budget int64 // bytes of decoded pixels held at once, DefaultDecodeBudget when 0
+}
+
+func (o DecodeOptions) budget() int64 {
+	if o.Budget <= 0 {
+		return DefaultDecodeBudget
+	}
+	return o.Budget
+}
+
+// ImageInfo is a file with its image dimensions. The pixels are only decoded
+// when Decode is called, so checks needing the dimensions alone never pay for
+// a full decode.
+type ImageInfo struct {
+	FileInfo
+	budget *decodeBudget
+}
+
+// Decode decodes the image. It waits while the images decoded by the stage
+// and not yet released exceed its budget, until ctx is cancelled; release
+// must be called once the image is no longer used. A consumer holding an
+// image must release it before decoding the next one, or it may wait for
+// itself.
+func (i ImageInfo) Decode(ctx context.Context) (image.Image, func(), error) {
+	n, err := i.budget.acquire(ctx, decodedSize(i.FileInfo))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img, _, err := resize.Decode(i.FullName())
+	if err != nil {
+		i.budget.release(n)
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	return img, func() { once.Do(func() { i.budget.release(n) }) }, nil
+}
+
+// decodedSize estimates the memory of the decoded image, 4 bytes a pixel.
+func decodedSize(f FileInfo) int64 {
+	return int64(f.Width) * int64(f.Height) * 4
+}
+
+// Decode is the decoding stage of the pipeline, sending the images of each
+// folder as one slice. The dimensions come from the image headers, read again
+// for files Load could not parse; files which cannot be read are skipped. At
+// most opts.Budget bytes of decoded pixels are held at once by the images of
+// the stage. Decoding stops when ctx is cancelled.
+func Decode(ctx context.Context, in <-chan FolderInfo, opts DecodeOptions, progress ProgressFunc) <-chan []ImageInfo {
+	out := make(chan []ImageInfo)
+
+	budget := newDecodeBudget(opts.budget())
+
+	go func() {
+		defer close(out)
+
+		done := 0
+		for folder := range in {
+			images := make([]ImageInfo, 0, len(folder.Files))
+
+			for _, f := range folder.Files {
+				if ctx.Err() != nil {
+					return
+				}
+
+				done++
+				progress.report(Progress{Stage: StageDecode, Done: done, Episode: folder.Name})
+
+				if f.Width == 0 || f.Height == 0 {
+					// unreadable files are reported by Load
+					img, err := file.ParseImage(f.FullName())
+					if err != nil {
+						continue
+					}
+
+					f.setImage(img)
+				}
+
+				images = append(images, ImageInfo{FileInfo: f, budget: budget})
+			}
+
+			select {
+			case out <- images:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// decodeBudget is a weighted semaphore bounding the memory of the decoded
+// images. A nil *decodeBudget does not bound them.
+type decodeBudget struct {
+	mu    sync.Mutex
+	size  int64
+	used  int64
+	freed chan struct{} // closed and replaced on every release
+}
+
+func newDecodeBudget(size int64) *decodeBudget {
+	return &decodeBudget{size: size, freed: make(chan struct{})}
+}
+
+// acquire waits until n bytes are free and takes them, or returns the error
+// of ctx when it is cancelled first. An image larger than the whole budget
+// takes all of it, so it is decoded alone. It returns the bytes taken.
+func (b *decodeBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if b == nil {
+		return n, nil
+	}
+	if n > b.size {
+		n = b.size
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.size {
+			b.used += n
+			b.mu.Unlock()
+			return n, nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (b *decodeBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
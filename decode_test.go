@@ -0,0 +1,39 @@
+package magicx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDecodeBudgetCancel(t *testing.T) {
+	b := newDecodeBudget(100)
+	held, err := b.acquire(context.Background(), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waits for the held bytes until the context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.acquire(ctx, 50); err != context.DeadlineExceeded {
+		t.Fatalf("acquire over the budget = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// and takes them once released
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.acquire(context.Background(), 50)
+		done <- err
+	}()
+	b.release(held)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire still waiting after release")
+	}
+}
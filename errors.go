@@ -0,0 +1,51 @@
+package magicx
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/xingbase/magicx/file"
+)
+
+// Operations of a FileError.
+const (
+	OpRead   = "read"
+	OpRename = "rename"
+	OpWrite  = "write"
+)
+
+// FileError is an operation which failed on a file of an episode folder. The
+// File name is empty when the folder itself could not be read.
+type FileError struct {
+	File FileInfo
+	Op   string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	name := e.File.Name
+	if name == "" {
+		name = e.File.Folder
+	}
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, name, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Rule returns the rule reporting the error.
+func (e FileError) Rule() RuleID {
+	switch {
+	case errors.Is(e.Err, fs.ErrPermission):
+		return RulePermissionDenied
+	case errors.Is(e.Err, file.ErrUnsupportedFormat):
+		return RuleUnsupportedFormat
+	case e.Op == OpRename:
+		return RuleRenameFailed
+	case e.Op == OpWrite:
+		return RuleWriteFailed
+	}
+	return RuleUnreadable
+}
@@ -0,0 +1,52 @@
+package file
+
+import "image/color"
+
+// Color modes of an image.
+const (
+	ColorRGB      = "rgb"
+	ColorGray     = "gray"
+	ColorCMYK     = "cmyk"
+	ColorYCCK     = "ycck"
+	ColorPaletted = "paletted"
+)
+
+// ColorMode returns the color mode, bits per channel and alpha channel of the
+// images of the color model, as returned by image.DecodeConfig or the
+// ColorModel of a decoded image. header is the beginning of the file, telling
+// Adobe YCCK JPEGs apart from CMYK ones, which decode to the same model.
+// Unknown models give an empty mode.
+func ColorMode(m color.Model, header []byte) (string, int, bool) {
+	switch m {
+	case color.GrayModel:
+		return ColorGray, 8, false
+	case color.Gray16Model:
+		return ColorGray, 16, false
+	case color.YCbCrModel, color.RGBAModel:
+		return ColorRGB, 8, false
+	case color.NYCbCrAModel, color.NRGBAModel:
+		return ColorRGB, 8, true
+	case color.RGBA64Model:
+		return ColorRGB, 16, false
+	case color.NRGBA64Model:
+		return ColorRGB, 16, true
+	case color.CMYKModel:
+		if adobeTransform(header) == 2 {
+			return ColorYCCK, 8, false
+		}
+		return ColorCMYK, 8, false
+	}
+
+	if p, ok := m.(color.Palette); ok {
+		alpha := false
+		for _, c := range p {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				alpha = true
+				break
+			}
+		}
+		return ColorPaletted, 8, alpha
+	}
+
+	return "", 0, false
+}
@@ -1,26 +1,98 @@
 package file
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
+	"io"
 	"os"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+
+	_ "golang.org/x/image/bmp"  // Import BMP decoder
+	_ "golang.org/x/image/tiff" // Import TIFF decoder
+	_ "golang.org/x/image/webp" // Import WebP decoder
 )
 
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
 var Extensions = map[string]bool{
 	".jpg":  true,
 	".jpeg": true,
 	".png":  true,
 	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// FormatExtensions are the extensions of each image format, as named by
+// image.DecodeConfig, the preferred one first.
+var FormatExtensions = map[string][]string{
+	"jpeg": {".jpg", ".jpeg"},
+	"png":  {".png"},
+	"gif":  {".gif"},
+	"webp": {".webp"},
+	"bmp":  {".bmp"},
+	"tiff": {".tif", ".tiff"},
+}
+
+// ExtensionFormat returns the image format of the extension, or an empty
+// string for unknown extensions.
+func ExtensionFormat(ext string) string {
+	ext = strings.ToLower(ext)
+	for format, exts := range FormatExtensions {
+		for _, e := range exts {
+			if e == ext {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// UnsupportedExtensions are image files which cannot be decoded. They are
+// reported instead of being skipped like other files.
+var UnsupportedExtensions = map[string]bool{
+	".heic": true,
+	".heif": true,
+	".avif": true,
+	".jxl":  true,
+	".jp2":  true,
+	".psd":  true,
+	".svg":  true,
+	".ico":  true,
+	".raw":  true,
+	".dng":  true,
+	".cr2":  true,
+	".nef":  true,
 }
 
 type Image struct {
-	Format string
-	Width  int
-	Height int
+	Format  string
+	Width   int
+	Height  int
+	Color   string // color mode, e.g. ColorRGB or ColorCMYK
+	Depth   int    // bits per channel
+	Alpha   bool   // has an alpha channel
+	Quality int    // estimated JPEG quality, 0 for other formats
+}
+
+// FolderName returns the last element of a relative folder path. Both "/"
+// and "\\" separate elements, so paths written on Windows give the same
+// episode folder on every OS.
+func FolderName(rel string) string {
+	parts := strings.FieldsFunc(rel, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	if len(parts) == 0 {
+		return rel
+	}
+	return parts[len(parts)-1]
 }
 
 func ExtractFolderNum(s string) (int, error) {
@@ -82,11 +154,35 @@ func HasThumbnail(s string) bool {
 	return strings.HasPrefix(s, "tmb")
 }
 
+var (
+	// episodeField is the 4-digit episode field of the default naming
+	// template, e.g. "0003" in "series2_0003_001.jpg".
+	episodeField = regexp.MustCompile(`_(\d{4})_`)
+	// episodeBeforePage is the number field followed by the page number at
+	// the end of the name, e.g. "3" in "series2_3_001.jpg" or "3_001.jpg".
+	episodeBeforePage = regexp.MustCompile(`(?:^|_)(\d+)_\d+(?:\.[^.]*)?$`)
+)
+
+// ExtractEpisodeNum returns the episode number of a page name: its 4-digit
+// "_NNNN_" field, else the number field just before the page number. Digits
+// elsewhere in the name, such as in the series, are ignored.
+func ExtractEpisodeNum(s string) (int, error) {
+	match := episodeField.FindStringSubmatch(s)
+	if match == nil {
+		match = episodeBeforePage.FindStringSubmatch(s)
+	}
+	if match == nil {
+		return 0, fmt.Errorf("no episode number found in file name")
+	}
+
+	return strconv.Atoi(match[1])
+}
+
+// HasMismatch reports whether the episode number of the page name differs
+// from the one of its folder.
 func HasMismatch(folder string, file string) bool {
 	a, _ := ExtractFolderNum(folder)
-	b, _ := ExtractFileNum(file)
-
-	// log.Println("folder ", folder, " n ", a, " file ", file, " n ", b)
+	b, _ := ExtractEpisodeNum(file)
 
 	return a != b
 }
@@ -114,14 +210,56 @@ func ParseImage(path string) (Image, error) {
 	}
 	defer file.Close()
 
-	config, format, err := image.DecodeConfig(file)
+	return parseConfig(file)
+}
+
+// ParseImageBytes parses the image metadata of encoded image data, like
+// ParseImage.
+func ParseImageBytes(data []byte) (Image, error) {
+	return parseConfig(bytes.NewReader(data))
+}
+
+// parseConfig decodes the image config of r, keeping the header it reads to
+// tell the color mode and JPEG quality.
+func parseConfig(r io.Reader) (Image, error) {
+	var header bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &header))
 	if err != nil {
 		return Image{}, err
 	}
 
-	return Image{
+	img := Image{
 		Format: format,
 		Width:  config.Width,
 		Height: config.Height,
-	}, nil
+	}
+	img.Color, img.Depth, img.Alpha = ColorMode(config.ColorModel, header.Bytes())
+	if format == "jpeg" {
+		img.Quality = jpegQuality(header.Bytes())
+	}
+	return img, nil
+}
+
+// ParseSize parses a size such as "20MB", "10240KB", "50 KB" or "51200"
+// into bytes. Units are powers of 1024, like FormatSize.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	s = strings.TrimSuffix(s, "B")
+
+	mul := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGTPE", s[n-1]); i >= 0 {
+			for ; i >= 0; i-- {
+				mul *= 1024
+			}
+			s = s[:n-1]
+		}
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(f * float64(mul)), nil
 }
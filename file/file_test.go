@@ -0,0 +1,111 @@
+package file
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestFolderName(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"0001", "0001"},
+		{"series/0001", "0001"},
+		{`series\0001`, "0001"},
+		{`vol2\series\0003`, "0003"},
+		{`series\0001\`, "0001"},
+		{`D:\comics\series\0012`, "0012"},
+		{`vol2/series\0004`, "0004"},
+		{".", "."},
+	}
+
+	for _, tt := range tests {
+		if got := FolderName(tt.rel); got != tt.want {
+			t.Errorf("FolderName(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestHasMismatchBackslashTree(t *testing.T) {
+	tests := []struct {
+		rel  string
+		file string
+		want bool
+	}{
+		{`vol2\0003`, "abc_0003_001.jpg", false},
+		{`vol2\0003`, "abc_0004_001.jpg", true},
+		{`series1\0002`, "abc_0002_010.jpg", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasMismatch(FolderName(tt.rel), tt.file); got != tt.want {
+			t.Errorf("HasMismatch(FolderName(%q), %q) = %v, want %v", tt.rel, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestHasMismatchDigitInSeries(t *testing.T) {
+	tests := []struct {
+		folder string
+		file   string
+		want   bool
+	}{
+		{"0003", "series2_0003_001.jpg", false},
+		{"0003", "series2_0004_001.jpg", true},
+		{"0003", "2nd_season_0003_001.jpg", false},
+		{"3", "series2_3_001.jpg", false},
+		{"3", "3_001.jpg", false},
+		{"3", "series2_4_001.jpg", true},
+		{"0003", "series2.jpg", true},
+	}
+
+	for _, tt := range tests {
+		if got := HasMismatch(tt.folder, tt.file); got != tt.want {
+			t.Errorf("HasMismatch(%q, %q) = %v, want %v", tt.folder, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestParseImageBytesQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+
+	for _, quality := range []int{1, 25, 40, 50, 75, 90, 100} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ParseImageBytes(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Quality != quality {
+			t.Errorf("quality %d estimated as %d", quality, got.Quality)
+		}
+	}
+}
+
+func TestPerceptualHashBlank(t *testing.T) {
+	black := image.NewGray(image.Rect(0, 0, 100, 100))
+	white := image.NewGray(image.Rect(0, 0, 100, 100))
+	drawn := image.NewGray(image.Rect(0, 0, 100, 100))
+	for i := range white.Pix {
+		white.Pix[i] = 0xff
+		if i%100 < 50 {
+			drawn.Pix[i] = 0xff
+		}
+	}
+
+	if _, ok := PerceptualHash(black); ok {
+		t.Error("black page hashed, want it taken as blank")
+	}
+	if _, ok := PerceptualHash(white); ok {
+		t.Error("white page hashed, want it taken as blank")
+	}
+	if _, ok := PerceptualHash(drawn); !ok {
+		t.Error("half white page taken as blank")
+	}
+}
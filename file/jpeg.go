@@ -0,0 +1,156 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	markerSOS   = 0xda
+	markerDQT   = 0xdb
+	markerAPP14 = 0xee
+)
+
+// luminance is the luminance quantization table of the JPEG standard, in
+// zigzag order, scaled by the IJG encoders to the quality.
+var luminance = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14,
+	13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37,
+	29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68,
+	87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113,
+	121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// jpegSegments calls fn with the marker and data of every segment of a JPEG
+// header, until the first scan, the end of the header or fn returns false.
+func jpegSegments(header []byte, fn func(marker byte, segment []byte) bool) {
+	if len(header) < 2 || header[0] != 0xff || header[1] != 0xd8 {
+		return
+	}
+
+	for i := 2; i+4 <= len(header); {
+		if header[i] != 0xff {
+			return
+		}
+
+		marker := header[i+1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			i++
+			continue
+		case marker >= 0xd0 && marker <= 0xd7, marker == 0x01:
+			// markers without a segment
+			i += 2
+			continue
+		case marker == markerSOS:
+			return
+		}
+
+		n := int(binary.BigEndian.Uint16(header[i+2:]))
+		if n < 2 {
+			return
+		}
+		end := i + 2 + n
+		if end > len(header) {
+			end = len(header)
+		}
+
+		if !fn(marker, header[i+4:end]) {
+			return
+		}
+
+		i += 2 + n
+	}
+}
+
+// adobeTransform returns the color transform of the Adobe APP14 segment of a
+// JPEG header: 0 for CMYK or RGB, 1 for YCbCr and 2 for YCCK. It returns -1
+// when the header has none.
+func adobeTransform(header []byte) int {
+	transform := -1
+	jpegSegments(header, func(marker byte, segment []byte) bool {
+		if marker == markerAPP14 && len(segment) >= 12 && bytes.HasPrefix(segment, []byte("Adobe")) {
+			transform = int(segment[11])
+			return false
+		}
+		return true
+	})
+	return transform
+}
+
+// jpegQuality estimates the quality a JPEG was saved at from its luminance
+// quantization table: the IJG quality, from 1 to 100, whose scaled standard
+// table is the closest. It returns 0 when the header has no such table.
+func jpegQuality(header []byte) int {
+	var table []int
+	jpegSegments(header, func(marker byte, segment []byte) bool {
+		if marker != markerDQT {
+			return true
+		}
+
+		// a segment may define several tables
+		for len(segment) > 0 {
+			precision, id := segment[0]>>4, segment[0]&0x0f
+			size := 64
+			if precision != 0 {
+				size = 128
+			}
+			if len(segment) < 1+size {
+				return false
+			}
+
+			if id == 0 {
+				table = make([]int, 64)
+				for i := range table {
+					if precision != 0 {
+						table[i] = int(binary.BigEndian.Uint16(segment[1+2*i:]))
+					} else {
+						table[i] = int(segment[1+i])
+					}
+				}
+				return false
+			}
+
+			segment = segment[1+size:]
+		}
+		return true
+	})
+	if table == nil {
+		return 0
+	}
+
+	quality, best := 0, -1
+	for q := 100; q >= 1; q-- {
+		scale := 200 - 2*q
+		if q < 50 {
+			scale = 5000 / q
+		}
+
+		diff := 0
+		for i, v := range luminance {
+			scaled := (v*scale + 50) / 100
+			if scaled < 1 {
+				scaled = 1
+			} else if scaled > 255 {
+				scaled = 255
+			}
+
+			if d := table[i] - scaled; d < 0 {
+				diff -= d
+			} else {
+				diff += d
+			}
+		}
+
+		// ties go to the higher quality
+		if best < 0 || diff < best {
+			quality, best = q, diff
+		}
+	}
+
+	return quality
+}
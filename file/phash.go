@@ -0,0 +1,104 @@
+package file
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// phashSize is the side of the grayscale thumbnail transformed by the DCT.
+	phashSize = 32
+	// phashBits is the side of the lowest frequencies kept in the hash.
+	phashBits = 8
+	// phashMinDeviation is the standard deviation of the gray levels of the
+	// thumbnail under which an image is taken as uniform, e.g. a blank page
+	// with scanning noise.
+	phashMinDeviation = 6
+)
+
+// phashCos are the DCT-II coefficients cos((2x+1)uπ/2N) of the kept
+// frequencies u.
+var phashCos = func() [phashBits][phashSize]float64 {
+	var c [phashBits][phashSize]float64
+	for u := 0; u < phashBits; u++ {
+		for x := 0; x < phashSize; x++ {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	return c
+}()
+
+// PerceptualHash returns the 64-bit perceptual hash of img: each bit tells
+// whether one of the 8x8 lowest frequencies of the DCT of its 32x32
+// grayscale thumbnail is above their median. Rescaled or re-encoded copies of
+// an image get hashes a few bits apart, see Similarity. It returns false for
+// near uniform images, such as blank pages, whose hash tells nothing about
+// them: all of them would look the same.
+func PerceptualHash(img image.Image) (uint64, bool) {
+	gray := image.NewGray(image.Rect(0, 0, phashSize, phashSize))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	if deviation(gray) < phashMinDeviation {
+		return 0, false
+	}
+
+	// rows then columns, only for the kept frequencies
+	var rows [phashSize][phashBits]float64
+	for y := 0; y < phashSize; y++ {
+		for u := 0; u < phashBits; u++ {
+			sum := 0.0
+			for x := 0; x < phashSize; x++ {
+				sum += float64(gray.Pix[y*gray.Stride+x]) * phashCos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+
+	coefs := make([]float64, 0, phashBits*phashBits)
+	for v := 0; v < phashBits; v++ {
+		for u := 0; u < phashBits; u++ {
+			sum := 0.0
+			for y := 0; y < phashSize; y++ {
+				sum += rows[y][u] * phashCos[v][y]
+			}
+			coefs = append(coefs, sum)
+		}
+	}
+
+	// the DC term is the mean brightness, left out of the median
+	sorted := append([]float64(nil), coefs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coefs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, true
+}
+
+// deviation returns the standard deviation of the gray levels of img.
+func deviation(img *image.Gray) float64 {
+	sum, sumSquares := 0.0, 0.0
+	for _, p := range img.Pix {
+		v := float64(p)
+		sum += v
+		sumSquares += v * v
+	}
+
+	n := float64(len(img.Pix))
+	mean := sum / n
+	return math.Sqrt(math.Max(sumSquares/n-mean*mean, 0))
+}
+
+// Similarity returns the share of equal bits of two perceptual hashes, in
+// percent.
+func Similarity(a, b uint64) int {
+	return (64 - bits.OnesCount64(a^b)) * 100 / 64
+}
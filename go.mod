@@ -4,12 +4,12 @@ go 1.19
 
 require (
 	fyne.io/fyne/v2 v2.5.2
+	github.com/BurntSushi/toml v1.4.0
 	golang.org/x/image v0.22.0
 )
 
 require (
 	fyne.io/systray v1.11.0 // indirect
-	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
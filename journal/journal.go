@@ -0,0 +1,379 @@
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// FileName is the journal file written in the root folder.
+	FileName = ".magicx-journal.json"
+	// BackupDir is the folder, in the root folder, keeping the original
+	// content of replaced and deleted files.
+	BackupDir = ".magicx-backup"
+)
+
+const (
+	OpRename  Op = "rename"
+	OpReplace Op = "replace"
+	OpCreate  Op = "create"
+	OpDelete  Op = "delete"
+)
+
+type Op string
+
+var ErrEmpty = errors.New("journal is empty")
+
+// Entry is a single file operation. Paths are relative to the root folder and
+// "/" separated, so a journal written on Windows can be undone on macOS.
+// Checksum is the SHA-256 of the file the operation left, or of the original
+// content for replaced and deleted files, whose written content has its own
+// checksum in Written.
+type Entry struct {
+	Op       Op     `json:"op"`
+	Path     string `json:"path"`
+	Original string `json:"original,omitempty"`
+	Backup   string `json:"backup,omitempty"`
+	Checksum string `json:"checksum"`
+	Written  string `json:"written,omitempty"`
+}
+
+// Run is the list of operations performed by one command.
+type Run struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Journal records the file operations of a run. A nil *Journal performs the
+// operations without recording them.
+type Journal struct {
+	root string
+	run  Run
+}
+
+// Begin starts recording a run of the command on the root folder.
+func Begin(root, command string) *Journal {
+	now := time.Now()
+	return &Journal{
+		root: root,
+		run: Run{
+			ID:      now.Format("20060102T150405.000000000"),
+			Command: command,
+			Time:    now,
+			Entries: make([]Entry, 0),
+		},
+	}
+}
+
+// Rename renames oldPath to newPath.
+func (j *Journal) Rename(oldPath, newPath string) error {
+	if j == nil {
+		return os.Rename(oldPath, newPath)
+	}
+
+	sum, err := Checksum(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+
+	j.add(Entry{Op: OpRename, Path: j.rel(newPath), Original: j.rel(oldPath), Checksum: sum})
+	return nil
+}
+
+// Replace writes data over the file at path atomically, keeping a backup of
+// the original content.
+func (j *Journal) Replace(path string, data []byte, perm os.FileMode) error {
+	if j == nil {
+		return WriteFile(path, data, perm)
+	}
+
+	backup, sum, err := j.backup(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteFile(path, data, perm); err != nil {
+		return err
+	}
+
+	written := sha256.Sum256(data)
+	j.add(Entry{Op: OpReplace, Path: j.rel(path), Backup: backup, Checksum: sum, Written: hex.EncodeToString(written[:])})
+	return nil
+}
+
+// Create writes data to a new file at path atomically.
+func (j *Journal) Create(path string, data []byte, perm os.FileMode) error {
+	if err := WriteFile(path, data, perm); err != nil {
+		return err
+	}
+
+	if j != nil {
+		sum := sha256.Sum256(data)
+		j.add(Entry{Op: OpCreate, Path: j.rel(path), Checksum: hex.EncodeToString(sum[:])})
+	}
+	return nil
+}
+
+// Delete removes the file at path, keeping a backup of its content.
+func (j *Journal) Delete(path string) error {
+	if j == nil {
+		return os.Remove(path)
+	}
+
+	backup, sum, err := j.backup(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	j.add(Entry{Op: OpDelete, Path: j.rel(path), Backup: backup, Checksum: sum})
+	return nil
+}
+
+// Commit appends the run to the journal file of the root folder. Runs
+// without operations are not written.
+func (j *Journal) Commit() error {
+	if j == nil || len(j.run.Entries) == 0 {
+		return nil
+	}
+
+	runs, err := Read(j.root)
+	if err != nil {
+		return err
+	}
+
+	return write(j.root, append(runs, j.run))
+}
+
+// Read returns the runs recorded in the journal of the root folder, oldest
+// first.
+func Read(root string) ([]Run, error) {
+	data, err := os.ReadFile(filepath.Join(root, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Run{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]Run, 0)
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("%s: %w", FileName, err)
+	}
+	return runs, nil
+}
+
+// Undo reverts the last run recorded in the journal of the root folder and
+// removes it from the journal. Files changed or created since the run are
+// left as they are and reported in the returned error; the run then keeps
+// only their entries, so undoing again retries them alone.
+func Undo(root string) (Run, error) {
+	runs, err := Read(root)
+	if err != nil {
+		return Run{}, err
+	}
+	if len(runs) == 0 {
+		return Run{}, ErrEmpty
+	}
+
+	run := runs[len(runs)-1]
+
+	var errs []error
+	failed := make([]Entry, 0)
+	for i := len(run.Entries) - 1; i >= 0; i-- {
+		e := run.Entries[i]
+		if err := revert(root, e); err != nil {
+			errs = append(errs, err)
+			failed = append([]Entry{e}, failed...)
+			continue
+		}
+
+		// the backups of the failed entries are kept for the next undo
+		if e.Backup != "" {
+			os.Remove(filepath.Join(root, filepath.FromSlash(e.Backup)))
+		}
+	}
+
+	if len(errs) > 0 {
+		runs[len(runs)-1].Entries = failed
+		if err := write(root, runs); err != nil {
+			return run, err
+		}
+		return run, fmt.Errorf("%d operations could not be reverted, first: %w", len(errs), errs[0])
+	}
+
+	if err := write(root, runs[:len(runs)-1]); err != nil {
+		return run, err
+	}
+
+	return run, os.RemoveAll(filepath.Join(root, BackupDir, run.ID))
+}
+
+func revert(root string, e Entry) error {
+	path := filepath.Join(root, filepath.FromSlash(e.Path))
+
+	switch e.Op {
+	case OpRename:
+		if err := verify(path, e.Checksum); err != nil {
+			return err
+		}
+		original := filepath.Join(root, filepath.FromSlash(e.Original))
+		if err := absent(original); err != nil {
+			return err
+		}
+		return os.Rename(path, original)
+
+	case OpCreate:
+		if err := verify(path, e.Checksum); err != nil {
+			return err
+		}
+		return os.Remove(path)
+
+	case OpReplace, OpDelete:
+		// the file must still be the one the run left
+		if e.Op == OpDelete {
+			if err := absent(path); err != nil {
+				return err
+			}
+		} else if e.Written != "" {
+			if err := verify(path, e.Written); err != nil {
+				return err
+			}
+		}
+
+		backup := filepath.Join(root, filepath.FromSlash(e.Backup))
+		if err := verify(backup, e.Checksum); err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(backup)
+		if err != nil {
+			return err
+		}
+		return WriteFile(path, data, 0644)
+	}
+
+	return fmt.Errorf("unknown journal operation %q", e.Op)
+}
+
+// verify reports an error when the file content does not match the checksum.
+func verify(path, checksum string) error {
+	sum, err := Checksum(path)
+	if err != nil {
+		return err
+	}
+	if sum != checksum {
+		return fmt.Errorf("%s has changed since the run", path)
+	}
+	return nil
+}
+
+// absent reports an error when a file exists at path, so reverting does not
+// overwrite a file written since the run.
+func absent(path string) error {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return fmt.Errorf("%s has been created since the run", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (j *Journal) add(e Entry) {
+	j.run.Entries = append(j.run.Entries, e)
+}
+
+// backup copies the file at path to the backup folder of the run.
+func (j *Journal) backup(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	rel := filepath.Join(BackupDir, j.run.ID, j.rel(path))
+	if err := os.MkdirAll(filepath.Join(j.root, filepath.Dir(rel)), 0755); err != nil {
+		return "", "", err
+	}
+	if err := WriteFile(filepath.Join(j.root, rel), data, 0644); err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return filepath.ToSlash(rel), hex.EncodeToString(sum[:]), nil
+}
+
+func (j *Journal) rel(path string) string {
+	rel, err := filepath.Rel(j.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func write(root string, runs []Run) error {
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(filepath.Join(root, FileName), data, 0644)
+}
+
+// Checksum returns the hex encoded SHA-256 of the file content.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteFile writes data to a temporary file next to path and renames it
+// over path, so readers never observe a partially written file.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,162 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndoRenameReplace(t *testing.T) {
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a.jpg"), filepath.Join(root, "b.jpg")
+	writeFile(t, a, "a")
+	writeFile(t, b, "b")
+
+	j := Begin(root, "test")
+	if err := j.Rename(a, filepath.Join(root, "c.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Replace(b, []byte("resized"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Undo(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, a); got != "a" {
+		t.Errorf("a.jpg = %q, want %q", got, "a")
+	}
+	if got := readFile(t, b); got != "b" {
+		t.Errorf("b.jpg = %q, want %q", got, "b")
+	}
+	if runs, _ := Read(root); len(runs) != 0 {
+		t.Errorf("got %d runs after undo, want 0", len(runs))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, BackupDir)); len(entries) != 0 {
+		t.Errorf("backups left after undo: %v", entries)
+	}
+}
+
+func TestUndoChangedFile(t *testing.T) {
+	root := t.TempDir()
+	names := []string{"1.jpg", "2.jpg", "3.jpg"}
+
+	j := Begin(root, "test")
+	for _, name := range names {
+		writeFile(t, filepath.Join(root, name), name)
+		if err := j.Rename(filepath.Join(root, name), filepath.Join(root, "x"+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// changed after the run, so it cannot be reverted
+	writeFile(t, filepath.Join(root, "x2.jpg"), "changed")
+
+	if _, err := Undo(root); err == nil {
+		t.Fatal("undo of a changed file succeeded")
+	}
+
+	runs, err := Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || len(runs[0].Entries) != 1 || runs[0].Entries[0].Path != "x2.jpg" {
+		t.Fatalf("journal after a partial undo = %+v, want the x2.jpg rename only", runs)
+	}
+
+	// once the file is restored, undoing again reverts the remaining entry
+	writeFile(t, filepath.Join(root, "x2.jpg"), "2.jpg")
+	if _, err := Undo(root); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		if got := readFile(t, filepath.Join(root, name)); got != name {
+			t.Errorf("%s = %q, want %q", name, got, name)
+		}
+	}
+	if runs, _ := Read(root); len(runs) != 0 {
+		t.Errorf("got %d runs after undo, want 0", len(runs))
+	}
+}
+
+func TestUndoReplacedFileEdited(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "1.jpg")
+	writeFile(t, path, "orig")
+
+	j := Begin(root, "test")
+	if err := j.Replace(path, []byte("resized"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, "user edit after run")
+
+	if _, err := Undo(root); err == nil {
+		t.Fatal("undo over an edited file succeeded")
+	}
+	if got := readFile(t, path); got != "user edit after run" {
+		t.Errorf("1.jpg = %q, want the edit kept", got)
+	}
+	if runs, _ := Read(root); len(runs) != 1 || len(runs[0].Entries) != 1 {
+		t.Errorf("journal after a failed undo = %+v, want the replace kept", runs)
+	}
+}
+
+func TestUndoRenameOriginalTaken(t *testing.T) {
+	root := t.TempDir()
+	oldPath, newPath := filepath.Join(root, "x_1.jpg"), filepath.Join(root, "x_001.jpg")
+	writeFile(t, oldPath, "page")
+
+	j := Begin(root, "test")
+	if err := j.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new delivery arrives under the original name
+	writeFile(t, oldPath, "new delivery")
+
+	if _, err := Undo(root); err == nil {
+		t.Fatal("undo over a new file succeeded")
+	}
+	if got := readFile(t, oldPath); got != "new delivery" {
+		t.Errorf("x_1.jpg = %q, want the new delivery kept", got)
+	}
+	if got := readFile(t, newPath); got != "page" {
+		t.Errorf("x_001.jpg = %q, want %q", got, "page")
+	}
+	if runs, _ := Read(root); len(runs) != 1 || len(runs[0].Entries) != 1 {
+		t.Errorf("journal after a failed undo = %+v, want the rename kept", runs)
+	}
+}
@@ -0,0 +1,383 @@
+package magicx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xingbase/magicx/cache"
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/resize"
+)
+
+// LoadOptions configures Load.
+type LoadOptions struct {
+	Concurrency    int          // files parsed in parallel, runtime.NumCPU() when 0
+	Cache          *cache.Cache // metadata of the files unchanged since the last scan
+	PerceptualHash bool         // decode the pages to compute their FileInfo.PHash
+}
+
+func (o LoadOptions) workers() int {
+	if o.Concurrency <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Concurrency
+}
+
+// Load scans the episode folders of the series in dir and sends each folder
+// as soon as the image headers of its files are parsed. The headers are
+// parsed by a pool of workers; the folders are sent in episode order, see
+// EpisodeLess, with their files in walk order, whatever the concurrency.
+// Files and folders which cannot be read are sent as FileErrors of their
+// folder. With a cache, only the files changed since the last scan are
+// parsed; the cache is updated but not saved. With opts.PerceptualHash the
+// pages are also decoded for their perceptual hash. Sending stops when ctx
+// is cancelled. It returns an error when the series folder itself cannot be
+// read.
+func Load(ctx context.Context, dir string, opts LoadOptions, progress ProgressFunc) (<-chan FolderInfo, error) {
+	if err := readable(dir); err != nil {
+		return nil, err
+	}
+
+	out := make(chan FolderInfo)
+
+	go func() {
+		defer close(out)
+
+		files, failed, err := walk(ctx, dir)
+		if err != nil {
+			return
+		}
+
+		rels := make([]string, len(files))
+		for i, f := range files {
+			rels[i], _ = filepath.Rel(dir, f.FullName())
+		}
+		opts.Cache.Retain(rels)
+
+		// indexes of the files and walk errors of every folder
+		members := make(map[string][]int)
+		folderErrors := make(map[string][]FileError)
+		names := make([]string, 0)
+		for i, f := range files {
+			if _, ok := members[f.Folder]; !ok {
+				names = append(names, f.Folder)
+			}
+			members[f.Folder] = append(members[f.Folder], i)
+		}
+		for _, e := range failed {
+			if _, ok := members[e.File.Folder]; !ok {
+				names = append(names, e.File.Folder)
+				members[e.File.Folder] = nil
+			}
+			folderErrors[e.File.Folder] = append(folderErrors[e.File.Folder], e)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return EpisodeLess(names[i], names[j])
+		})
+
+		order := make([]int, 0, len(files))
+		pending := make(map[string]int, len(names))
+		for _, name := range names {
+			order = append(order, members[name]...)
+			pending[name] = len(members[name])
+		}
+
+		// errs is written by the parse workers, each at the index it parses
+		errs := make([]error, len(files))
+
+		next, done := 0, 0
+		send := func() bool {
+			for next < len(names) && pending[names[next]] == 0 {
+				name := names[next]
+
+				folder := FolderInfo{
+					Name:   name,
+					Files:  make([]FileInfo, 0, len(members[name])),
+					Errors: folderErrors[name],
+				}
+				for _, j := range members[name] {
+					folder.Size += files[j].Size
+					folder.Files = append(folder.Files, files[j])
+					if errs[j] != nil {
+						folder.Errors = append(folder.Errors, FileError{File: files[j], Op: OpRead, Err: errs[j]})
+					}
+				}
+
+				select {
+				case out <- folder:
+				case <-ctx.Done():
+					return false
+				}
+				next++
+			}
+			return true
+		}
+
+		// folders without files are ready from the start
+		if !send() {
+			return
+		}
+
+		for i := range parse(ctx, files, rels, errs, order, opts) {
+			done++
+			progress.report(Progress{Stage: StageLoad, Done: done, Total: len(files), Episode: files[i].Folder})
+
+			pending[files[i].Folder]--
+			if !send() {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// readable reports an error when dir is not a folder which can be listed.
+func readable(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	return nil
+}
+
+// EpisodeLess reports whether the episode folder a comes before b: by episode
+// number, so "2" comes before "10", then by name. Folders without a number
+// come first.
+func EpisodeLess(a, b string) bool {
+	na, _ := file.ExtractFolderNum(a)
+	nb, _ := file.ExtractFolderNum(b)
+	if na != nb {
+		return na < nb
+	}
+	return a < b
+}
+
+// Collect receives every folder of the stage.
+func Collect(in <-chan FolderInfo) []FolderInfo {
+	folders := make([]FolderInfo, 0)
+	for folder := range in {
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+// walk lists the image files of the series without their image metadata,
+// and the files and folders which cannot be read, including the series
+// folder when it becomes unreadable after Load checked it. It only fails
+// when ctx is cancelled.
+func walk(ctx context.Context, dir string) ([]FileInfo, []FileError, error) {
+	files := make([]FileInfo, 0)
+	failed := make([]FileError, 0)
+
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err != nil {
+			e := FileError{File: FileInfo{Path: path, Folder: folderName(dir, path)}, Op: OpRead, Err: err}
+			if info == nil || !info.IsDir() {
+				e.File = FileInfo{Path: filepath.Dir(path), Folder: folderName(dir, filepath.Dir(path)), Name: filepath.Base(path)}
+			}
+			failed = append(failed, e)
+
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// skip hidden folders such as the journal backups
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		folder := folderName(dir, filepath.Dir(path))
+
+		if file.UnsupportedExtensions[ext] {
+			e := FileError{
+				File: FileInfo{Path: filepath.Dir(path), Folder: folder, Name: info.Name(), Ext: ext, Size: info.Size()},
+				Op:   OpRead,
+				Err:  fmt.Errorf("%w: %s", file.ErrUnsupportedFormat, ext),
+			}
+			failed = append(failed, e)
+			return nil
+		}
+		if !file.Extensions[ext] {
+			return nil
+		}
+
+		fileInfo := FileInfo{
+			Path:        filepath.Dir(path),
+			Folder:      folder,
+			Name:        info.Name(),
+			Ext:         ext,
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			IsStandard:  true,
+			IsThumbnail: file.HasThumbnail(info.Name()),
+		}
+
+		if !fileInfo.IsThumbnail {
+			fileInfo.IsMissmatch = file.HasMismatch(folder, info.Name())
+		}
+
+		files = append(files, fileInfo)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, failed, nil
+}
+
+// folderName returns the episode folder name of the folder at path.
+func folderName(dir, path string) string {
+	rPath, _ := filepath.Rel(dir, path)
+
+	// extract episode folder name
+	return file.FolderName(rPath)
+}
+
+// parse fills in the image metadata of the files with the workers of opts,
+// in the given order, and sends the index of every parsed file. The errors
+// are written to errs at the index of the file. Each worker only writes the
+// elements it is given, so files keeps its order. The pages decoded for their
+// perceptual hash hold at most DefaultDecodeBudget bytes at once.
+func parse(ctx context.Context, files []FileInfo, rels []string, errs []error, order []int, opts LoadOptions) <-chan int {
+	n := opts.workers()
+	budget := newDecodeBudget(DefaultDecodeBudget)
+
+	jobs := make(chan int)
+	parsed := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				errs[i] = parseFile(ctx, &files[i], rels[i], opts, budget)
+
+				select {
+				case parsed <- i:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+
+		for _, i := range order {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(parsed)
+	}()
+
+	return parsed
+}
+
+// parseFile fills in the image metadata of the file, from the cache when the
+// file is unchanged, and its perceptual hash when opts asks for it.
+// Unreadable files are not cached so their error is reported on every scan.
+func parseFile(ctx context.Context, f *FileInfo, rel string, opts LoadOptions, budget *decodeBudget) error {
+	c := opts.Cache
+	if c == nil {
+		// parsing for image metadata
+		img, err := file.ParseImage(f.FullName())
+		f.setImage(img)
+		if err != nil {
+			return err
+		}
+		return hashPage(ctx, f, opts, budget)
+	}
+
+	e, ok := c.Get(rel, f.Size, f.ModTime)
+	if ok {
+		f.setImage(file.Image{Format: e.Format, Width: e.Width, Height: e.Height, Color: e.Color, Depth: e.Depth, Alpha: e.Alpha, Quality: e.Quality})
+		f.PHash, f.Hashed, f.Blank = e.PHash, e.Hashed, e.Blank
+	} else {
+		img, err := file.ParseImage(f.FullName())
+		if err != nil {
+			return err
+		}
+
+		f.setImage(img)
+		e = cache.Entry{
+			Size:    f.Size,
+			ModTime: f.ModTime.UnixNano(),
+			Width:   img.Width,
+			Height:  img.Height,
+			Format:  img.Format,
+			Color:   img.Color,
+			Depth:   img.Depth,
+			Alpha:   img.Alpha,
+			Quality: img.Quality,
+		}
+	}
+
+	if err := hashPage(ctx, f, opts, budget); err != nil {
+		return err
+	}
+
+	if !ok || e.Hashed != f.Hashed {
+		e.PHash, e.Hashed, e.Blank = f.PHash, f.Hashed, f.Blank
+		c.Put(rel, e)
+	}
+	return nil
+}
+
+// hashPage decodes the page to compute its perceptual hash when opts asks for
+// it and it is not known yet. Thumbnails are not hashed.
+func hashPage(ctx context.Context, f *FileInfo, opts LoadOptions, budget *decodeBudget) error {
+	if !opts.PerceptualHash || f.IsThumbnail || f.Hashed {
+		return nil
+	}
+
+	n, err := budget.acquire(ctx, decodedSize(*f))
+	if err != nil {
+		return err
+	}
+	defer budget.release(n)
+
+	img, _, err := resize.Decode(f.FullName())
+	if err != nil {
+		return err
+	}
+
+	hash, ok := file.PerceptualHash(img)
+	f.PHash, f.Hashed, f.Blank = hash, true, !ok
+	return nil
+}
@@ -0,0 +1,127 @@
+package magicx
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xingbase/magicx/cache"
+)
+
+func writePage(t *testing.T, path string, width int) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, width, 10))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadNestedTree(t *testing.T) {
+	dir := t.TempDir()
+	writePage(t, filepath.Join(dir, "series2", "0001", "abc_0001_001.png"), 20)
+	writePage(t, filepath.Join(dir, "series2", "0001", "abc_0001_002.png"), 20)
+	writePage(t, filepath.Join(dir, "series2", "0002", "abc_0003_001.png"), 20)
+
+	loaded, err := Load(context.Background(), dir, LoadOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folders := Collect(loaded)
+	if len(folders) != 2 {
+		t.Fatalf("got %d folders, want 2", len(folders))
+	}
+
+	for i, want := range []string{"0001", "0002"} {
+		if folders[i].Name != want {
+			t.Errorf("folder %d = %q, want %q", i, folders[i].Name, want)
+		}
+
+		for _, f := range folders[i].Files {
+			if f.Folder != want {
+				t.Errorf("%s folder = %q, want %q", f.Name, f.Folder, want)
+			}
+			if _, err := os.Stat(f.FullName()); err != nil {
+				t.Errorf("FullName of %s: %v", f.Name, err)
+			}
+		}
+	}
+
+	if f := folders[0].Files[0]; f.IsMissmatch {
+		t.Errorf("%s reported as mismatch", f.Name)
+	}
+	if f := folders[1].Files[0]; !f.IsMissmatch {
+		t.Errorf("%s not reported as mismatch", f.Name)
+	}
+}
+
+func TestFullNameJoinsWithOSSeparator(t *testing.T) {
+	f := FileInfo{Path: filepath.Join("series", "0001"), Name: "abc_0001_001.jpg"}
+
+	want := "series" + string(filepath.Separator) + "0001" + string(filepath.Separator) + "abc_0001_001.jpg"
+	if got := f.FullName(); got != want {
+		t.Errorf("FullName() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadEpisodeOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"10", "2", "1"} {
+		writePage(t, filepath.Join(dir, name, "abc_00"+name+"_001.png"), 20)
+	}
+
+	loaded, err := Load(context.Background(), dir, LoadOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folders := Collect(loaded)
+	want := []string{"1", "2", "10"}
+	if len(folders) != len(want) {
+		t.Fatalf("got %d folders, want %d", len(folders), len(want))
+	}
+	for i := range want {
+		if folders[i].Name != want[i] {
+			t.Errorf("folder %d = %q, want %q", i, folders[i].Name, want[i])
+		}
+	}
+}
+
+func TestLoadCachesBlankPages(t *testing.T) {
+	dir := t.TempDir()
+	writePage(t, filepath.Join(dir, "0001", "abc_0001_001.png"), 20)
+
+	c := cache.Open(dir)
+	loaded, err := Load(context.Background(), dir, LoadOptions{Cache: c, PerceptualHash: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders := Collect(loaded)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := folders[0].Files[0]
+	if !f.Hashed || !f.Blank {
+		t.Errorf("black page Hashed = %v, Blank = %v, want both", f.Hashed, f.Blank)
+	}
+
+	// the black page hashes to 0, the cache must still know it is hashed so
+	// it is not decoded again
+	e, ok := cache.Open(dir).Get("0001/abc_0001_001.png", f.Size, f.ModTime)
+	if !ok || !e.Hashed || !e.Blank {
+		t.Errorf("cached black page = %+v, %v, want hashed and blank", e, ok)
+	}
+}
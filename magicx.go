@@ -1,3 +1,9 @@
+// Package magicx checks and fixes the episode folders of a series.
+//
+// The work is split into pipeline stages connected by channels of
+// FolderInfo, one episode folder at a time: Load scans the series, Reanme,
+// Thumbnails and Converts fix it, Decode hands out the pages to decode on
+// demand and Check validates them into the EpisodeReports of a Report.
 package magicx
 
 import (
@@ -5,15 +11,13 @@ import (
 	_ "image/gif"  //   Import GIF decoder
 	_ "image/jpeg" // Import JPEG decoder
 	_ "image/png"  // Import PNG decoder
-	"io/fs"
-	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/naming"
 )
 
 const (
@@ -25,6 +29,10 @@ type Language int8
 
 var UnderImageSize int64 = 5120 // 5KB
 
+// DefaultSimilarity is the similarity in percent of the perceptual hashes
+// from which pages are duplicates, at most 6 of 64 bits apart.
+var DefaultSimilarity = 90
+
 var LimitedSizeInfoByContentType = map[string]LimitedSizeInfo{
 	"comic": {
 		Image:     ImageSize{Width: 1600, Size: 20971520}, // 20MB
@@ -38,15 +46,101 @@ var LimitedSizeInfoByContentType = map[string]LimitedSizeInfo{
 	},
 }
 
+// ContentTypes returns the known content types in alphabetical order.
+func ContentTypes() []string {
+	types := make([]string, 0, len(LimitedSizeInfoByContentType))
+	for contentType := range LimitedSizeInfoByContentType {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	return types
+}
+
 type LimitedSizeInfo struct {
-	Folder    int64
-	Image     ImageSize
-	Thumbnail ThumbnailSize
+	Folder     int64
+	Under      int64 // minimum page and thumbnail size, UnderImageSize when 0
+	Image      ImageSize
+	Thumbnail  ThumbnailSize
+	Rules      []RuleID // enabled rules, DefaultRules when empty
+	Naming     string   // page naming template checked by RuleNaming
+	Formats    []string // allowed image formats, e.g. "jpeg", any when empty
+	Similarity int      // minimum similarity in percent of duplicate pages, DefaultSimilarity when 0
+}
+
+// AllowsFormat reports whether pages of the image format are allowed.
+func (l LimitedSizeInfo) AllowsFormat(format string) bool {
+	if len(l.Formats) == 0 {
+		return true
+	}
+	for _, f := range l.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// NamingTemplate returns the page naming template of the content type.
+func (l LimitedSizeInfo) NamingTemplate() string {
+	if l.Naming == "" {
+		return naming.DefaultTemplate
+	}
+	return l.Naming
+}
+
+// MinSimilarity returns the similarity in percent from which two pages are
+// reported as duplicates.
+func (l LimitedSizeInfo) MinSimilarity() int {
+	if l.Similarity == 0 {
+		return DefaultSimilarity
+	}
+	return l.Similarity
+}
+
+// UsesPerceptualHash reports whether the enabled rules compare the
+// perceptual hashes of the pages, which Load only computes on demand.
+func (l LimitedSizeInfo) UsesPerceptualHash() bool {
+	for _, id := range l.EnabledRules() {
+		if id == RuleDuplicate || id == RuleSeriesDuplicate {
+			return true
+		}
+	}
+	return false
+}
+
+// MinSize returns the minimum page and thumbnail size of the content type.
+func (l LimitedSizeInfo) MinSize() int64 {
+	if l.Under == 0 {
+		return UnderImageSize
+	}
+	return l.Under
+}
+
+// EnabledRules returns the ids of the rules enabled for the content type,
+// followed by the ErrorRules it does not list.
+func (l LimitedSizeInfo) EnabledRules() []RuleID {
+	rules := l.Rules
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+
+	enabled := append([]RuleID(nil), rules...)
+	for _, id := range ErrorRules {
+		listed := false
+		for _, rule := range rules {
+			listed = listed || rule == id
+		}
+		if !listed {
+			enabled = append(enabled, id)
+		}
+	}
+	return enabled
 }
 
 type ImageSize struct {
-	Width int
-	Size  int64
+	Width   int
+	Size    int64
+	Quality int // minimum estimated JPEG quality of the pages, unchecked when 0
 }
 type ThumbnailSize struct {
 	Width int
@@ -54,9 +148,10 @@ type ThumbnailSize struct {
 }
 
 type FolderInfo struct {
-	Name  string
-	Size  int64
-	Files []FileInfo
+	Name   string
+	Size   int64
+	Files  []FileInfo
+	Errors []FileError // failed operations, reported by the error rules
 }
 
 type FileInfo struct {
@@ -65,136 +160,44 @@ type FileInfo struct {
 	Name        string
 	Ext         string
 	Size        int64
+	ModTime     time.Time
 	Width       int
 	Height      int
 	Format      string
+	Color       string // color mode, e.g. file.ColorRGB or file.ColorCMYK
+	Depth       int    // bits per channel
+	Alpha       bool   // has an alpha channel
+	Quality     int    // estimated JPEG quality, 0 for other formats
+	PHash       uint64 // perceptual hash of the page, valid when Hashed
+	Hashed      bool   // PHash is computed, set when LoadOptions.PerceptualHash
+	Blank       bool   // near uniform page, e.g. a white page, left out of the duplicate rules
 	IsStandard  bool
 	IsThumbnail bool
 	IsMissmatch bool
 }
 
 func (f FileInfo) FullName() string {
-	return f.Path + "/" + f.Name
+	return filepath.Join(f.Path, f.Name)
 }
 
-func Load(dir string) <-chan []FolderInfo {
-	out := make(chan []FolderInfo)
-
-	go func() {
-		defer close(out)
-
-		files := make(map[string][]FileInfo)
-
-		err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			if !info.IsDir() {
-				ext := strings.ToLower(filepath.Ext(path))
-
-				if file.Extensions[ext] {
-					rPath, _ := filepath.Rel(dir, filepath.Dir(path))
-
-					// extract episode folder name
-					parts := strings.Split(rPath, "/")
-					folder := parts[len(parts)-1]
-
-					// parsing for image metadata
-					img, err := file.ParseImage(path)
-					if err != nil {
-						fmt.Printf("Failed to parse image %s: %v\n", path, err)
-					}
-
-					fileInfo := FileInfo{
-						Path:        filepath.Dir(path),
-						Folder:      folder,
-						Name:        info.Name(),
-						Ext:         ext,
-						Size:        info.Size(),
-						Width:       img.Width,
-						Height:      img.Height,
-						Format:      img.Format,
-						IsStandard:  true,
-						IsThumbnail: file.HasThumbnail(info.Name()),
-					}
-
-					if !fileInfo.IsThumbnail {
-						fileInfo.IsMissmatch = file.HasMismatch(folder, info.Name())
-					}
-
-					files[folder] = append(files[folder], fileInfo)
-				}
-			}
-
-			return nil
-		})
-		if err != nil {
-			fmt.Println("Error walking through directory: ", err)
-		}
-
-		data := make([]FolderInfo, 0)
-		for folder, fileInfos := range files {
-			var folderSize int64
-			for _, file := range fileInfos {
-				folderSize += file.Size
-			}
-
-			folderInfo := FolderInfo{
-				Name:  folder,
-				Size:  folderSize,
-				Files: fileInfos,
-			}
-			data = append(data, folderInfo)
-		}
-
-		out <- data
-	}()
-
-	return out
+// ColorMode describes the color mode of the file, e.g. "cmyk" or
+// "rgb 16-bit alpha".
+func (f FileInfo) ColorMode() string {
+	mode := f.Color
+	if f.Depth > 8 {
+		mode += fmt.Sprintf(" %d-bit", f.Depth)
+	}
+	if f.Alpha {
+		mode += " alpha"
+	}
+	return mode
 }
 
-func Reanme(in <-chan []FolderInfo) <-chan []FolderInfo {
-	out := make(chan []FolderInfo)
-
-	go func() {
-		defer close(out)
-
-		for folderInfos := range in {
-			for i := range folderInfos {
-				for j, file := range folderInfos[i].Files {
-					// split file names with "_"
-					parts := strings.Split(file.Name, "_")
-
-					if len(parts) > 0 {
-						// extract the last numbering part
-						last := parts[len(parts)-1]
-						num := strings.TrimSuffix(last, file.Ext)
-
-						// add padding if the num is less then 3 digits
-						if len(num) < 3 {
-							newNum := fmt.Sprintf("%03s", num)
-							newName := strings.Replace(file.Name, num+file.Ext, newNum+file.Ext, 1)
-							newFile := file.Path + "/" + newName
-
-							// try to rename the file
-							err := os.Rename(file.FullName(), newFile)
-							if err != nil {
-								fmt.Printf("Failed to rename file %s: %v\n", file.Name, err)
-							}
-
-							// update to the new file name
-							folderInfos[i].Files[j].Name = newName
-						}
-					}
-				}
-			}
-			// send results to an output channel
-			out <- folderInfos
-		}
-	}()
-
-	return out
+// setImage fills in the image metadata parsed from the file.
+func (f *FileInfo) setImage(img file.Image) {
+	f.Width, f.Height, f.Format = img.Width, img.Height, img.Format
+	f.Color, f.Depth, f.Alpha = img.Color, img.Depth, img.Alpha
+	f.Quality = img.Quality
 }
 
 func EpisodeName(n int, lang Language) string {
@@ -222,50 +225,3 @@ func Println(title string, data map[string]struct{}) {
 		fmt.Println()
 	}
 }
-
-func ConsoleLog(folders, images, sizeOver, thumbs, mismatch, notFoundThumbs, notFoundImages, noNumberings map[string]struct{}) string {
-	var results strings.Builder
-
-	logging := func(title string, items map[string]struct{}) {
-		if len(items) > 0 {
-			results.WriteString(fmt.Sprintf("\n# %s\n", title))
-			keys := make([]string, 0, len(items))
-			for k := range items {
-				keys = append(keys, k)
-			}
-
-			sort.Slice(keys, func(i, j int) bool {
-				numI := extractNumber(keys[i])
-				numJ := extractNumber(keys[j])
-				return numI < numJ
-			})
-
-			results.WriteString(strings.Join(keys, ", "))
-			results.WriteString("\n")
-		}
-	}
-
-	// logging("1話の容量が60MBを超えていた話", folders) // don't check
-	logging("1話内で横幅が統一されていない話", images)
-	logging("1ページの容量が20MB以上の話", sizeOver)
-	// logging("話サムネの容量が50KB以上になっていた話", thumbs) // don't check
-	logging("フォルダ名とファイル名一致していない話", mismatch)
-	logging("サムネがない話", notFoundThumbs)
-	logging("イメージがない話", notFoundImages)
-	logging("ページ表記が順番になってない話", noNumberings)
-	return results.String()
-}
-
-func extractNumber(s string) int {
-	re := regexp.MustCompile(`\d+`)
-	numStr := re.FindString(s)
-	if numStr == "" {
-		return 0
-	}
-	// 문자열을 정수로 변환
-	num, err := strconv.Atoi(numStr)
-	if err != nil {
-		return 0
-	}
-	return num
-}
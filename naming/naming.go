@@ -0,0 +1,196 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	FieldSeries  = "series"
+	FieldEpisode = "episode"
+	FieldPage    = "page"
+	FieldExt     = "ext"
+)
+
+// DefaultTemplate is the page naming of most deliveries.
+const DefaultTemplate = "{series}_{episode:04}_{page:03}.{ext}"
+
+// Fields are the values of the fields of a file name.
+type Fields struct {
+	Series  string
+	Episode int
+	Page    int
+	Ext     string // without the leading dot
+}
+
+type part struct {
+	literal string
+	field   string
+	width   int
+}
+
+// Template is a file naming template such as
+// "{series}_{episode:04}_{page:03}.{ext}". Numeric fields take an optional
+// zero-padded width.
+type Template struct {
+	raw   string
+	parts []part
+	re    *regexp.Regexp
+}
+
+// Parse parses a naming template.
+func Parse(s string) (*Template, error) {
+	t := &Template{raw: s}
+	seen := make(map[string]bool)
+
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	for rest := s; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+			expr.WriteString(regexp.QuoteMeta(rest[:open]))
+		}
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("naming template %q: unclosed {", s)
+		}
+
+		p, err := parseField(rest[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("naming template %q: %w", s, err)
+		}
+		if seen[p.field] {
+			return nil, fmt.Errorf("naming template %q: field %s used twice", s, p.field)
+		}
+		seen[p.field] = true
+
+		t.parts = append(t.parts, p)
+		expr.WriteString(p.pattern())
+
+		rest = rest[open+end+1:]
+	}
+
+	expr.WriteString("$")
+	t.re = regexp.MustCompile(expr.String())
+
+	return t, nil
+}
+
+func parseField(s string) (part, error) {
+	name, width, hasWidth := strings.Cut(s, ":")
+
+	p := part{field: name}
+	switch name {
+	case FieldEpisode, FieldPage:
+		if hasWidth {
+			n, err := strconv.Atoi(width)
+			if err != nil || n <= 0 {
+				return part{}, fmt.Errorf("invalid width %q of field %s", width, name)
+			}
+			p.width = n
+		}
+	case FieldSeries, FieldExt:
+		if hasWidth {
+			return part{}, fmt.Errorf("field %s takes no width", name)
+		}
+	default:
+		return part{}, fmt.Errorf("unknown field %q", name)
+	}
+
+	return p, nil
+}
+
+func (p part) pattern() string {
+	switch p.field {
+	case FieldSeries:
+		return `(.+?)`
+	case FieldExt:
+		return `([A-Za-z0-9]+)`
+	}
+	if p.width > 0 {
+		return fmt.Sprintf(`(\d{%d,})`, p.width)
+	}
+	return `(\d+)`
+}
+
+// Has reports whether the template has the field.
+func (t *Template) Has(field string) bool {
+	for _, p := range t.parts {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Match extracts the fields of the file name. It returns false when the name
+// does not have the shape of the template.
+func (t *Template) Match(name string) (Fields, bool) {
+	m := t.re.FindStringSubmatch(name)
+	if m == nil {
+		return Fields{}, false
+	}
+
+	var f Fields
+	i := 1
+	for _, p := range t.parts {
+		if p.field == "" {
+			continue
+		}
+
+		switch p.field {
+		case FieldSeries:
+			f.Series = m[i]
+		case FieldExt:
+			f.Ext = m[i]
+		case FieldEpisode:
+			f.Episode, _ = strconv.Atoi(m[i])
+		case FieldPage:
+			f.Page, _ = strconv.Atoi(m[i])
+		}
+		i++
+	}
+
+	return f, true
+}
+
+// Conforms reports whether the file name is written exactly as the template
+// would format it, including the zero-padding.
+func (t *Template) Conforms(name string) bool {
+	f, ok := t.Match(name)
+	return ok && t.Format(f) == name
+}
+
+// Format returns the file name of the fields.
+func (t *Template) Format(f Fields) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case FieldSeries:
+			b.WriteString(f.Series)
+		case FieldExt:
+			b.WriteString(f.Ext)
+		case FieldEpisode:
+			b.WriteString(fmt.Sprintf("%0*d", p.width, f.Episode))
+		case FieldPage:
+			b.WriteString(fmt.Sprintf("%0*d", p.width, f.Page))
+		}
+	}
+	return b.String()
+}
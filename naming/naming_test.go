@@ -0,0 +1,79 @@
+package naming
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{DefaultTemplate, false},
+		{"{episode}-{page:2}.{ext}", false},
+		{"{series}_{page}.jpg", false},
+		{"{series}_{episode:04", true},
+		{"{series}_{chapter}.{ext}", true},
+		{"{series:3}_{page}.{ext}", true},
+		{"{page:0}.{ext}", true},
+		{"{page:x}.{ext}", true},
+		{"{page}_{page}.{ext}", true},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tmpl, err := Parse(DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		want   Fields
+		wantOK bool
+	}{
+		{"abc_0003_001.jpg", Fields{Series: "abc", Episode: 3, Page: 1, Ext: "jpg"}, true},
+		{"series_2_0012_010.png", Fields{Series: "series_2", Episode: 12, Page: 10, Ext: "png"}, true},
+		{"abc_00003_0001.jpg", Fields{Series: "abc", Episode: 3, Page: 1, Ext: "jpg"}, true},
+		{"abc_3_1.jpg", Fields{}, false},
+		{"page_1.jpg", Fields{}, false},
+		{"_0003_001.jpg", Fields{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := tmpl.Match(tt.name)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("Match(%q) = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestConforms(t *testing.T) {
+	tmpl, err := Parse(DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"abc_0003_001.jpg", true},
+		{"series2_0003_001.jpg", true},
+		{"abc_00003_001.jpg", false},
+		{"abc_0003_1.jpg", false},
+		{"abc_0003_001", false},
+		{"_0003_001.jpg", false},
+	}
+
+	for _, tt := range tests {
+		if got := tmpl.Conforms(tt.name); got != tt.want {
+			t.Errorf("Conforms(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package magicx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/naming"
+)
+
+// ProfileFileName is the name of the profiles file looked up by
+// DefaultProfilePath.
+const ProfileFileName = "magicx.toml"
+
+// size is a byte size written as a number of bytes or with a unit, e.g.
+// "20MB" or "50KB".
+type size struct {
+	bytes int64
+	set   bool
+}
+
+func (s *size) UnmarshalText(text []byte) error {
+	n, err := file.ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	s.bytes, s.set = n, true
+	return nil
+}
+
+type profileFile struct {
+	Folder     size     `toml:"folder"`
+	Under      size     `toml:"under"`
+	Rules      []RuleID `toml:"rules"`
+	Naming     string   `toml:"naming"`
+	Formats    []string `toml:"formats"`
+	Similarity int      `toml:"similarity"`
+	Image      struct {
+		Width   int  `toml:"width"`
+		Size    size `toml:"size"`
+		Quality int  `toml:"quality"`
+	} `toml:"image"`
+	Thumbnail struct {
+		Width int  `toml:"width"`
+		Size  size `toml:"size"`
+	} `toml:"thumbnail"`
+}
+
+// LoadProfiles reads content type profiles from a TOML file such as
+//
+//	[comic]
+//	folder = "60MB"
+//	under = "5KB"
+//	rules = ["width", "image_size", "mismatch", "naming"]
+//	naming = "{series}_{episode:04}_{page:03}.{ext}"
+//	formats = ["jpeg"]
+//	similarity = 90
+//
+//	[comic.image]
+//	width = 1600
+//	size = "20MB"
+//	quality = 70
+//
+//	[comic.thumbnail]
+//	width = 500
+//	size = "50KB"
+//
+// The built-in content types are used as defaults: a profile named after one
+// of them only overrides the keys it sets, other profiles start empty and
+// must set every limit.
+func LoadProfiles(path string) (map[string]LimitedSizeInfo, error) {
+	files := make(map[string]profileFile)
+
+	md, err := toml.DecodeFile(path, &files)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+	}
+
+	profiles := make(map[string]LimitedSizeInfo, len(LimitedSizeInfoByContentType)+len(files))
+	for name, limited := range LimitedSizeInfoByContentType {
+		profiles[name] = limited
+	}
+
+	for name, pf := range files {
+		limited := profiles[name]
+
+		if pf.Folder.set {
+			limited.Folder = pf.Folder.bytes
+		}
+		if pf.Under.set {
+			limited.Under = pf.Under.bytes
+		}
+		if pf.Rules != nil {
+			limited.Rules = pf.Rules
+		}
+		if pf.Naming != "" {
+			limited.Naming = pf.Naming
+		}
+		if pf.Formats != nil {
+			limited.Formats = pf.Formats
+		}
+		if pf.Similarity != 0 {
+			limited.Similarity = pf.Similarity
+		}
+		if pf.Image.Width != 0 {
+			limited.Image.Width = pf.Image.Width
+		}
+		if pf.Image.Size.set {
+			limited.Image.Size = pf.Image.Size.bytes
+		}
+		if pf.Image.Quality != 0 {
+			limited.Image.Quality = pf.Image.Quality
+		}
+		if pf.Thumbnail.Width != 0 {
+			limited.Thumbnail.Width = pf.Thumbnail.Width
+		}
+		if pf.Thumbnail.Size.set {
+			limited.Thumbnail.Size = pf.Thumbnail.Size.bytes
+		}
+
+		if err := limited.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %w", path, name, err)
+		}
+
+		profiles[name] = limited
+	}
+
+	return profiles, nil
+}
+
+// UseProfiles loads the profiles file and replaces
+// LimitedSizeInfoByContentType with its profiles.
+func UseProfiles(path string) error {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+
+	LimitedSizeInfoByContentType = profiles
+	return nil
+}
+
+// DefaultProfilePath returns the profiles file used when none is given: a
+// magicx.toml next to the executable, else in the user config directory. It
+// returns an empty string when neither exists.
+func DefaultProfilePath() string {
+	candidates := make([]string, 0, 2)
+
+	if exe, err := os.Executable(); err == nil {
+		candidates = append(candidates, filepath.Join(filepath.Dir(exe), ProfileFileName))
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "magicx", ProfileFileName))
+	}
+
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// Validate reports the first invalid limit of the content type.
+func (l LimitedSizeInfo) Validate() error {
+	switch {
+	case l.Folder <= 0:
+		return fmt.Errorf("folder size must be positive")
+	case l.Image.Width <= 0:
+		return fmt.Errorf("image width must be positive")
+	case l.Image.Size <= 0:
+		return fmt.Errorf("image size must be positive")
+	case l.Thumbnail.Width <= 0:
+		return fmt.Errorf("thumbnail width must be positive")
+	case l.Thumbnail.Size <= 0:
+		return fmt.Errorf("thumbnail size must be positive")
+	case l.Under < 0:
+		return fmt.Errorf("under size must not be negative")
+	case l.Image.Quality < 0 || l.Image.Quality > 100:
+		return fmt.Errorf("image quality must be between 0 and 100")
+	case l.Similarity < 0 || l.Similarity > 100:
+		return fmt.Errorf("similarity must be between 0 and 100")
+	}
+
+	if l.Naming != "" {
+		if _, err := naming.Parse(l.Naming); err != nil {
+			return err
+		}
+	}
+
+	for _, format := range l.Formats {
+		if _, ok := file.FormatExtensions[format]; !ok {
+			return fmt.Errorf("unknown image format %q", format)
+		}
+	}
+
+	registered := make(map[RuleID]bool)
+	for _, id := range RegisteredRules() {
+		registered[id] = true
+	}
+	for _, id := range l.Rules {
+		if !registered[id] {
+			return fmt.Errorf("unknown rule %q", id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package magicx
+
+// Stages of the pipeline reported in Progress.
+const (
+	StageLoad      = "load"
+	StageRename    = "rename"
+	StageThumbnail = "thumbnail"
+	StageConvert   = "convert"
+	StageDecode    = "decode"
+	StageCheck     = "check"
+)
+
+// Progress is the state of a pipeline stage.
+type Progress struct {
+	Stage   string
+	Done    int    // files processed
+	Total   int    // files to process, 0 when the stage does not know it
+	Episode string // folder of the last processed file
+}
+
+// ProgressFunc receives the progress of a stage. It is called from the stage
+// goroutines, one call at a time, and must return quickly. A nil ProgressFunc
+// is not called.
+type ProgressFunc func(Progress)
+
+func (fn ProgressFunc) report(p Progress) {
+	if fn != nil {
+		fn(p)
+	}
+}
@@ -0,0 +1,305 @@
+package magicx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+	"github.com/xingbase/magicx/naming"
+)
+
+// RenameOp renames a single file of an episode folder.
+type RenameOp struct {
+	Folder    string
+	Path      string
+	Old       string
+	New       string
+	Collision bool // the new name is already taken, the op is never applied
+}
+
+func (op RenameOp) String() string {
+	s := fmt.Sprintf("%s/%s -> %s", op.Folder, op.Old, op.New)
+	if op.Collision {
+		s += " (collision)"
+	}
+	return s
+}
+
+// RenamePlan is the list of renames to apply on a series. Nothing is renamed
+// on disk until Apply is called.
+type RenamePlan struct {
+	Ops []RenameOp
+}
+
+// Collisions returns the ops whose new name is already taken.
+func (p RenamePlan) Collisions() []RenameOp {
+	ops := make([]RenameOp, 0)
+	for _, op := range p.Ops {
+		if op.Collision {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// String lists the ops of the plan, one per line.
+func (p RenamePlan) String() string {
+	var b strings.Builder
+	for _, op := range p.Ops {
+		b.WriteString(op.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ErrNameTaken is the error of the renames skipped because their new name
+// collides with another file or rename.
+var ErrNameTaken = errors.New("new name already taken")
+
+// ErrNoSeries is returned by PlanTemplateRename when the template has a
+// series field and no series is given nor found in the page names.
+var ErrNoSeries = errors.New("no series name given nor found in the page names")
+
+// RenameErrors is returned by Apply when some files could not be renamed.
+type RenameErrors []error
+
+func (e RenameErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// PlanRename plans zero-padding the page number of every file name, the last
+// "_" separated token, to n digits. A rename collides when its new name is
+// already used by another file, e.g. "_1.jpg" when "_001.jpg" exists, or by
+// another rename.
+func PlanRename(folders []FolderInfo, n int) RenamePlan {
+	return planRename(folders, func(folder FolderInfo, f FileInfo) (string, bool) {
+		return padName(f.Name, n)
+	})
+}
+
+// PlanTemplateRename plans rewriting every page name which does not conform
+// to the naming template. Names having the shape of the template keep their
+// fields, other names take the episode number of their folder, their last
+// number as page number and the series name. When series is empty, the
+// series of the names already having the shape of the template is used; it
+// returns ErrNoSeries when there is none and a name needs it.
+func PlanTemplateRename(folders []FolderInfo, tmpl *naming.Template, series string) (RenamePlan, error) {
+	if series == "" {
+		series = inferSeries(folders, tmpl)
+	}
+
+	noSeries := false
+	plan := planRename(folders, func(folder FolderInfo, f FileInfo) (string, bool) {
+		if f.IsThumbnail || tmpl.Conforms(f.Name) {
+			return "", false
+		}
+
+		fields, ok := tmpl.Match(f.Name)
+		if !ok {
+			if series == "" && tmpl.Has(naming.FieldSeries) {
+				noSeries = true
+				return "", false
+			}
+
+			episode, err := file.ExtractFolderNum(folder.Name)
+			if err != nil {
+				return "", false
+			}
+			page, err := file.ExtractFileExtNum(f.Name, f.Ext)
+			if err != nil {
+				return "", false
+			}
+
+			fields = naming.Fields{
+				Series:  series,
+				Episode: episode,
+				Page:    page,
+				Ext:     strings.TrimPrefix(f.Ext, "."),
+			}
+		}
+
+		newName := tmpl.Format(fields)
+		return newName, newName != f.Name
+	})
+	if noSeries {
+		return RenamePlan{}, ErrNoSeries
+	}
+
+	return plan, nil
+}
+
+// inferSeries returns the most common series of the names having the shape
+// of the template.
+func inferSeries(folders []FolderInfo, tmpl *naming.Template) string {
+	counts := make(map[string]int)
+	series := ""
+
+	for _, folder := range folders {
+		for _, f := range folder.Files {
+			fields, ok := tmpl.Match(f.Name)
+			if !ok || f.IsThumbnail || fields.Series == "" {
+				continue
+			}
+
+			counts[fields.Series]++
+			if counts[fields.Series] > counts[series] {
+				series = fields.Series
+			}
+		}
+	}
+
+	return series
+}
+
+func planRename(folders []FolderInfo, rename func(folder FolderInfo, f FileInfo) (string, bool)) RenamePlan {
+	plan := RenamePlan{Ops: make([]RenameOp, 0)}
+
+	for _, folder := range folders {
+		names := make(map[string]bool, len(folder.Files))
+		for _, f := range folder.Files {
+			names[strings.ToLower(f.Name)] = true
+		}
+
+		targets := make(map[string]int)
+
+		for _, f := range folder.Files {
+			newName, ok := rename(folder, f)
+			if !ok {
+				continue
+			}
+
+			op := RenameOp{Folder: folder.Name, Path: f.Path, Old: f.Name, New: newName}
+
+			key := strings.ToLower(newName)
+			if names[key] {
+				op.Collision = true
+			} else if _, err := os.Stat(filepath.Join(f.Path, newName)); err == nil {
+				op.Collision = true
+			}
+			if i, ok := targets[key]; ok {
+				op.Collision = true
+				plan.Ops[i].Collision = true
+			}
+
+			targets[key] = len(plan.Ops)
+			plan.Ops = append(plan.Ops, op)
+		}
+	}
+
+	return plan
+}
+
+// Apply renames the files of the plan through the journal, skipping
+// collisions, and updates the file names of folders. The failed renames are
+// added to the errors of their folder. It returns the number of files
+// renamed.
+func (p RenamePlan) Apply(folders []FolderInfo, j *journal.Journal) (int, error) {
+	renamed := make(map[string]string)
+	failed := make(map[string]error)
+
+	var errs RenameErrors
+	for _, op := range p.Ops {
+		if op.Collision {
+			continue
+		}
+
+		oldPath := filepath.Join(op.Path, op.Old)
+		if err := j.Rename(oldPath, filepath.Join(op.Path, op.New)); err != nil {
+			failed[oldPath] = err
+			continue
+		}
+
+		renamed[oldPath] = op.New
+	}
+
+	for i := range folders {
+		for j, f := range folders[i].Files {
+			if err, ok := failed[f.FullName()]; ok {
+				e := FileError{File: f, Op: OpRename, Err: err}
+				folders[i].Errors = append(folders[i].Errors, e)
+				errs = append(errs, e)
+			}
+			if newName, ok := renamed[f.FullName()]; ok {
+				folders[i].Files[j].Name = newName
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return len(renamed), errs
+	}
+	return len(renamed), nil
+}
+
+// Reanme zero-pads the page number of every file name to n digits through
+// the journal, skipping the renames which would collide with another file.
+// Skipped and failed renames are added to the errors of their folder. When
+// ctx is cancelled the remaining folders are left as they are.
+func Reanme(ctx context.Context, in <-chan FolderInfo, n int, j *journal.Journal, progress ProgressFunc) <-chan FolderInfo {
+	out := make(chan FolderInfo)
+
+	go func() {
+		defer close(out)
+
+		done := 0
+		for folderInfo := range in {
+			if ctx.Err() != nil {
+				return
+			}
+
+			folders := []FolderInfo{folderInfo}
+
+			plan := PlanRename(folders, n)
+			for _, op := range plan.Collisions() {
+				for _, f := range folders[0].Files {
+					if f.Name == op.Old {
+						e := FileError{File: f, Op: OpRename, Err: fmt.Errorf("%w: %s", ErrNameTaken, op.New)}
+						folders[0].Errors = append(folders[0].Errors, e)
+					}
+				}
+			}
+
+			// failed renames are kept in the folder errors
+			plan.Apply(folders, j)
+
+			done += len(folderInfo.Files)
+			progress.report(Progress{Stage: StageRename, Done: done, Episode: folderInfo.Name})
+
+			// send results to an output channel
+			select {
+			case out <- folders[0]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// padName returns the name with its page number zero-padded to n digits. It
+// returns false when the name has no page number or it is already n digits
+// or longer.
+func padName(name string, n int) (string, bool) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	// extract the last numbering part
+	parts := strings.Split(base, "_")
+	num := parts[len(parts)-1]
+
+	if num == "" || len(num) >= n || strings.Trim(num, "0123456789") != "" {
+		return "", false
+	}
+
+	return strings.TrimSuffix(base, num) + fmt.Sprintf("%0*s", n, num) + ext, true
+}
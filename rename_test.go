@@ -0,0 +1,99 @@
+package magicx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanRename(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  []RenameOp
+	}{
+		{
+			[]string{"abc_0001_1.jpg", "abc_0001_002.jpg"},
+			[]RenameOp{{Old: "abc_0001_1.jpg", New: "abc_0001_001.jpg"}},
+		},
+		{
+			// the padded name is already taken
+			[]string{"abc_0001_1.jpg", "abc_0001_001.jpg"},
+			[]RenameOp{{Old: "abc_0001_1.jpg", New: "abc_0001_001.jpg", Collision: true}},
+		},
+		{
+			// whatever the case, for case-insensitive file systems
+			[]string{"abc_0001_1.JPG", "abc_0001_001.jpg"},
+			[]RenameOp{{Old: "abc_0001_1.JPG", New: "abc_0001_001.JPG", Collision: true}},
+		},
+		{
+			// two renames to the same name
+			[]string{"abc_0001_1.jpg", "abc_0001_01.jpg"},
+			[]RenameOp{
+				{Old: "abc_0001_1.jpg", New: "abc_0001_001.jpg", Collision: true},
+				{Old: "abc_0001_01.jpg", New: "abc_0001_001.jpg", Collision: true},
+			},
+		},
+		{
+			[]string{"abc_0001_001.jpg", "abc_0001_0002.jpg"},
+			[]RenameOp{},
+		},
+	}
+
+	for _, tt := range tests {
+		folder := FolderInfo{Name: "0001"}
+		for _, name := range tt.files {
+			folder.Files = append(folder.Files, FileInfo{Path: "0001", Name: name})
+		}
+
+		plan := PlanRename([]FolderInfo{folder}, 3)
+		if len(plan.Ops) != len(tt.want) {
+			t.Errorf("PlanRename(%v) = %v, want %v", tt.files, plan.Ops, tt.want)
+			continue
+		}
+		for i, op := range plan.Ops {
+			if op.Old != tt.want[i].Old || op.New != tt.want[i].New || op.Collision != tt.want[i].Collision {
+				t.Errorf("PlanRename(%v) op %d = %v, want %v", tt.files, i, op, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestApplySkipsCollisions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "0001")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	folder := FolderInfo{Name: "0001"}
+	for _, name := range []string{"abc_0001_1.jpg", "abc_0001_001.jpg", "abc_0001_2.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		folder.Files = append(folder.Files, FileInfo{Path: dir, Name: name})
+	}
+	folders := []FolderInfo{folder}
+
+	renamed, err := PlanRename(folders, 3).Apply(folders, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 1 {
+		t.Errorf("Apply renamed %d files, want 1", renamed)
+	}
+
+	// the colliding page and the page it would overwrite are left as they are
+	for name, want := range map[string]string{
+		"abc_0001_1.jpg":   "abc_0001_1.jpg",
+		"abc_0001_001.jpg": "abc_0001_001.jpg",
+		"abc_0001_002.jpg": "abc_0001_2.jpg",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want the content of %s", name, data, err, want)
+		}
+	}
+
+	if got := folders[0].Files[2].Name; got != "abc_0001_002.jpg" {
+		t.Errorf("renamed file is named %q in its folder, want %q", got, "abc_0001_002.jpg")
+	}
+}
@@ -0,0 +1,107 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/xingbase/magicx"
+	"github.com/xingbase/magicx/file"
+)
+
+// bom makes Excel on Windows read the file as UTF-8.
+const bom = "\ufeff"
+
+var csvHeader = []string{
+	"type",
+	"episode",
+	"name",
+	"folder",
+	"pages",
+	"folder_size",
+	"standard_width",
+	"thumbnail",
+	"rule",
+	"severity",
+	"title",
+	"file",
+	"value",
+	"limit",
+	"unit",
+	"message",
+}
+
+// CSV writes the report as UTF-8 CSV with a byte order mark. Each episode
+// has a summary row followed by one row per finding.
+func CSV(w io.Writer, r magicx.Report, lang magicx.Language) error {
+	if _, err := io.WriteString(w, bom); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, e := range r.Episodes {
+		thumbnail := "no"
+		if magicx.HasThumbnail(e.Folder) {
+			thumbnail = "yes"
+		}
+
+		pages := 0
+		for _, f := range e.Folder.Files {
+			if !f.IsThumbnail {
+				pages++
+			}
+		}
+
+		summary := []string{
+			"episode",
+			strconv.Itoa(e.Number),
+			e.Name(lang),
+			e.Folder.Name,
+			strconv.Itoa(pages),
+			file.FormatSize(e.Folder.Size),
+			strconv.Itoa(magicx.StandardWidth(e.Folder)),
+			thumbnail,
+			"", "", "", "", "", "", "", "",
+		}
+		if err := cw.Write(summary); err != nil {
+			return err
+		}
+
+		for _, f := range e.Findings {
+			var path, value, limit string
+			if f.File.Name != "" {
+				path = f.File.FullName()
+			}
+			if f.Unit != "" {
+				value = strconv.FormatInt(f.Value, 10)
+				limit = strconv.FormatInt(f.Limit, 10)
+			}
+
+			row := []string{
+				"finding",
+				strconv.Itoa(e.Number),
+				e.Name(lang),
+				e.Folder.Name,
+				"", "", "", "",
+				string(f.Rule),
+				f.Severity.String(),
+				f.Rule.Title(lang),
+				path,
+				value,
+				limit,
+				string(f.Unit),
+				f.Describe(),
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,218 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/xingbase/magicx"
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/resize"
+)
+
+// PreviewWidth is the width of the page previews embedded in HTML reports.
+var PreviewWidth = 240
+
+// PreviewLimit is the maximum number of page previews embedded in an HTML
+// report, keeping the file small when most pages have findings.
+var PreviewLimit = 100
+
+// previewRules are the rules whose findings show a preview of the page: the
+// ones about how it looks. Findings about names or unreadable files do not.
+var previewRules = map[magicx.RuleID]bool{
+	magicx.RuleWidth:              true,
+	magicx.RuleImageSize:          true,
+	magicx.RuleUnderImageSize:     true,
+	magicx.RuleThumbnailSize:      true,
+	magicx.RuleUnderThumbnailSize: true,
+	magicx.RuleCMYK:               true,
+	magicx.RuleGrayscale:          true,
+	magicx.RuleAlpha:              true,
+	magicx.RuleDuplicate:          true,
+	magicx.RuleSeriesDuplicate:    true,
+}
+
+type htmlReport struct {
+	Title    string
+	Episodes []htmlEpisode
+	Findings int
+}
+
+type htmlEpisode struct {
+	Name          string
+	Folder        string
+	Pages         int
+	Size          string
+	StandardWidth int
+	Thumbnail     bool
+	Findings      []htmlFinding
+}
+
+type htmlFinding struct {
+	Severity string
+	Title    string
+	File     string
+	Metadata string
+	Message  string
+	Preview  template.URL
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+section { border-top: 1px solid #ccc; padding: 1em 0; }
+h2 { font-size: 1.1em; margin: 0 0 .5em; }
+.meta { color: #666; font-size: .9em; }
+table { border-collapse: collapse; width: 100%; margin-top: .5em; }
+th, td { border: 1px solid #ddd; padding: .4em; text-align: left; vertical-align: top; font-size: .9em; }
+th { background: #f4f4f4; }
+.error { color: #b00020; font-weight: bold; }
+.warning { color: #a86b00; font-weight: bold; }
+.ok { color: #2e7d32; }
+img { display: block; max-width: 100%; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">{{len .Episodes}} episodes, {{.Findings}} findings</p>
+{{range .Episodes}}
+<section>
+<h2>{{.Name}} <span class="meta">{{.Folder}}</span></h2>
+<p class="meta">{{.Pages}} pages, {{.Size}}, width {{.StandardWidth}}px, thumbnail {{if .Thumbnail}}yes{{else}}no{{end}}</p>
+{{if .Findings}}
+<table>
+<tr><th>Severity</th><th>Rule</th><th>File</th><th>Value</th><th>Preview</th></tr>
+{{range .Findings}}
+<tr>
+<td class="{{.Severity}}">{{.Severity}}</td>
+<td>{{.Title}}</td>
+<td>{{.File}}{{if .Metadata}}<br><span class="meta">{{.Metadata}}</span>{{end}}</td>
+<td>{{.Message}}</td>
+<td>{{if .Preview}}<img src="{{.Preview}}" alt="{{.File}}" loading="lazy">{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p class="ok">OK</p>
+{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// HTML writes the report as a single HTML file which works offline. Pages
+// with findings of the previewRules are embedded as downscaled JPEG previews,
+// up to PreviewLimit of them.
+func HTML(w io.Writer, r magicx.Report, lang magicx.Language) error {
+	doc := htmlReport{
+		Title:    "MagicX report",
+		Episodes: make([]htmlEpisode, 0, len(r.Episodes)),
+	}
+
+	previews := previewPages(r)
+
+	for _, e := range r.Episodes {
+		pages := 0
+		for _, f := range e.Folder.Files {
+			if !f.IsThumbnail {
+				pages++
+			}
+		}
+
+		episode := htmlEpisode{
+			Name:          e.Name(lang),
+			Folder:        e.Folder.Name,
+			Pages:         pages,
+			Size:          file.FormatSize(e.Folder.Size),
+			StandardWidth: magicx.StandardWidth(e.Folder),
+			Thumbnail:     magicx.HasThumbnail(e.Folder),
+			Findings:      make([]htmlFinding, 0, len(e.Findings)),
+		}
+
+		for _, f := range e.Findings {
+			finding := htmlFinding{
+				Severity: f.Severity.String(),
+				Title:    f.Rule.Title(lang),
+				Message:  f.Describe(),
+			}
+
+			if f.File.Name != "" {
+				path := f.File.FullName()
+
+				finding.File = f.File.Name
+				finding.Metadata = fmt.Sprintf("%s %dx%d %s", f.File.Format, f.File.Width, f.File.Height, file.FormatSize(f.File.Size))
+
+				if previewRules[f.Rule] {
+					finding.Preview = previews[path]
+				}
+			}
+
+			episode.Findings = append(episode.Findings, finding)
+			doc.Findings++
+		}
+
+		doc.Episodes = append(doc.Episodes, episode)
+	}
+
+	return htmlTemplate.Execute(w, doc)
+}
+
+// previewPages returns the previews of the pages with findings of the
+// previewRules, up to PreviewLimit of them, by full path. The pages are
+// decoded by the Decode stage, one at a time.
+func previewPages(r magicx.Report) map[string]template.URL {
+	files := make([]magicx.FileInfo, 0)
+	seen := make(map[string]bool)
+	for _, e := range r.Episodes {
+		for _, f := range e.Findings {
+			if f.File.Name == "" || !previewRules[f.Rule] || seen[f.File.FullName()] || len(files) == PreviewLimit {
+				continue
+			}
+			seen[f.File.FullName()] = true
+			files = append(files, f.File)
+		}
+	}
+
+	ctx := context.Background()
+	in := make(chan magicx.FolderInfo, 1)
+	in <- magicx.FolderInfo{Files: files}
+	close(in)
+
+	previews := make(map[string]template.URL, len(files))
+	for images := range magicx.Decode(ctx, in, magicx.DecodeOptions{}, nil) {
+		for _, i := range images {
+			previews[i.FullName()] = preview(ctx, i)
+		}
+	}
+	return previews
+}
+
+// preview returns the page as a data URL of a JPEG scaled to PreviewWidth,
+// or an empty URL when the page cannot be decoded.
+func preview(ctx context.Context, i magicx.ImageInfo) template.URL {
+	img, release, err := i.Decode(ctx)
+	if err != nil {
+		return ""
+	}
+	defer release()
+
+	if img.Bounds().Dx() > PreviewWidth {
+		img = resize.Scale(img, PreviewWidth)
+	}
+
+	var buf bytes.Buffer
+	if err := resize.Encode(&buf, img, "jpeg", 70); err != nil {
+		return ""
+	}
+
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/xingbase/magicx"
+)
+
+type jsonReport struct {
+	Episodes []jsonEpisode `json:"episodes"`
+	Findings []jsonFinding `json:"findings"`
+}
+
+type jsonEpisode struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Folder   string `json:"folder"`
+	Size     int64  `json:"size"`
+	Findings int    `json:"findings"`
+}
+
+type jsonFinding struct {
+	Episode  int           `json:"episode"`
+	Folder   string        `json:"folder"`
+	File     string        `json:"file,omitempty"`
+	Rule     magicx.RuleID `json:"rule"`
+	Severity string        `json:"severity"`
+	Title    string        `json:"title"`
+	Value    *int64        `json:"value,omitempty"`
+	Limit    *int64        `json:"limit,omitempty"`
+	Unit     magicx.Unit   `json:"unit,omitempty"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// JSON writes the report as an indented JSON document listing every
+// episode and every finding.
+func JSON(w io.Writer, r magicx.Report, lang magicx.Language) error {
+	doc := jsonReport{
+		Episodes: make([]jsonEpisode, 0, len(r.Episodes)),
+		Findings: make([]jsonFinding, 0),
+	}
+
+	for _, e := range r.Episodes {
+		doc.Episodes = append(doc.Episodes, jsonEpisode{
+			Number:   e.Number,
+			Name:     e.Name(lang),
+			Folder:   e.Folder.Name,
+			Size:     e.Folder.Size,
+			Findings: len(e.Findings),
+		})
+
+		for _, f := range e.Findings {
+			finding := jsonFinding{
+				Episode:  e.Number,
+				Folder:   e.Folder.Name,
+				Rule:     f.Rule,
+				Severity: f.Severity.String(),
+				Title:    f.Rule.Title(lang),
+				Unit:     f.Unit,
+				Message:  f.Describe(),
+			}
+			if f.File.Name != "" {
+				finding.File = f.File.FullName()
+			}
+			if f.Unit != "" {
+				value, limit := f.Value, f.Limit
+				finding.Value, finding.Limit = &value, &limit
+			}
+
+			doc.Findings = append(doc.Findings, finding)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,280 @@
+package resize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+)
+
+const (
+	// DefaultQuality is the JPEG quality used for the first re-encode.
+	DefaultQuality = 95
+	// MinQuality is the lowest JPEG quality reached before scaling down.
+	MinQuality = 60
+
+	maxIterations = 50
+)
+
+var (
+	ErrUnsupportedFormat = file.ErrUnsupportedFormat
+	ErrTooLarge          = errors.New("image cannot be reduced under the size limit")
+)
+
+type Options struct {
+	Width   int     // limit width in pixels, no limit when 0
+	Size    int64   // limit size in bytes, no limit when 0
+	Percent float64 // quality or scale kept on each iteration, e.g. 95.0
+	Quality int     // estimated JPEG quality of the source, unknown when 0
+}
+
+type Result struct {
+	Path    string
+	Format  string
+	Width   int
+	Height  int
+	Size    int64
+	Quality int // JPEG quality of the written file, 0 for other formats
+	Resized bool
+}
+
+// File resizes the image at path to fit the limits, writing the result over
+// the original file with the same name and format through the journal.
+// Files already within the limits are left untouched.
+func File(path string, opts Options, j *journal.Journal) (Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	img, format, err := Decode(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	bounds := img.Bounds()
+	result := Result{
+		Path:   path,
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Size:   info.Size(),
+	}
+
+	if !exceeds(result, opts) {
+		return result, nil
+	}
+
+	data, result, err := Reduce(img, format, opts)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", path, err)
+	}
+	result.Path = path
+
+	if err := j.Replace(path, data, info.Mode()); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// Reduce encodes img in format, scaling it down to the width limit and then
+// lowering the JPEG quality, or the scale for other formats, by
+// opts.Percent until the encoded size fits the size limit. JPEG starts at
+// the StartQuality of the source and is scaled down rather than compressed
+// again below MinQuality.
+func Reduce(img image.Image, format string, opts Options) ([]byte, Result, error) {
+	percent := opts.Percent
+	if percent <= 0 || percent >= 100 {
+		percent = 95
+	}
+
+	if opts.Width > 0 && img.Bounds().Dx() > opts.Width {
+		img = Scale(img, opts.Width)
+	}
+
+	quality := 0
+	if format == "jpeg" {
+		quality = StartQuality(opts.Quality)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < maxIterations; i++ {
+		buf.Reset()
+		if err := Encode(&buf, img, format, quality); err != nil {
+			return nil, Result{}, err
+		}
+
+		if opts.Size <= 0 || int64(buf.Len()) <= opts.Size {
+			bounds := img.Bounds()
+			return buf.Bytes(), Result{
+				Format:  format,
+				Width:   bounds.Dx(),
+				Height:  bounds.Dy(),
+				Size:    int64(buf.Len()),
+				Quality: quality,
+				Resized: true,
+			}, nil
+		}
+
+		if format == "jpeg" && quality > MinQuality {
+			quality = int(float64(quality) * percent / 100)
+			if quality < MinQuality {
+				quality = MinQuality
+			}
+			continue
+		}
+
+		width := int(float64(img.Bounds().Dx()) * percent / 100)
+		if width < 1 {
+			break
+		}
+		img = Scale(img, width)
+	}
+
+	return nil, Result{}, ErrTooLarge
+}
+
+// StartQuality returns the JPEG quality of the first re-encode of a source
+// saved at quality: re-encoding a JPEG above its own quality only grows the
+// file without restoring the detail it lost. Unknown qualities give
+// DefaultQuality.
+func StartQuality(quality int) int {
+	if quality <= 0 || quality > DefaultQuality {
+		return DefaultQuality
+	}
+	return quality
+}
+
+// Scale returns img scaled to width, keeping the aspect ratio. Grayscale
+// images stay grayscale, others are scaled to RGB.
+func Scale(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := newLike(img, image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Crop returns img scaled to width and cut to height from the top, keeping
+// the aspect ratio. The whole scaled image is returned when height is 0 or
+// larger than the scaled height.
+func Crop(img image.Image, width, height int) image.Image {
+	scaled := Scale(img, width)
+
+	bounds := scaled.Bounds()
+	if height <= 0 || height >= bounds.Dy() {
+		return scaled
+	}
+
+	dst := newLike(scaled, image.Rect(0, 0, width, height))
+	draw.Copy(dst, image.Point{}, scaled, image.Rect(0, 0, width, height), draw.Src, nil)
+	return dst
+}
+
+// newLike returns an empty image of the bounds in the color model of img,
+// grayscale for grayscale images so scaling does not turn them into larger
+// RGB files, RGB otherwise.
+func newLike(img image.Image, r image.Rectangle) draw.Image {
+	switch img.ColorModel() {
+	case color.GrayModel:
+		return image.NewGray(r)
+	case color.Gray16Model:
+		return image.NewGray16(r)
+	}
+	return image.NewRGBA(r)
+}
+
+// CanEncode reports whether Encode writes the image format.
+func CanEncode(format string) bool {
+	switch format {
+	case "jpeg", "png", "gif", "bmp", "tiff":
+		return true
+	}
+	return false
+}
+
+// Encode writes img in format. The quality is only used by JPEG, which
+// renders transparent areas white. WebP pages can be decoded but not
+// encoded.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case "jpeg":
+		if quality <= 0 {
+			quality = DefaultQuality
+		}
+		return jpeg.Encode(w, Flatten(img), &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, &gif.Options{NumColors: 256, Drawer: draw.FloydSteinberg})
+	case "bmp":
+		return bmp.Encode(w, img)
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// Flatten returns img drawn over a white background, or img itself when it
+// is opaque.
+func Flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	return ToRGB(img)
+}
+
+// ToRGB returns img as an opaque 8-bit RGB image drawn over a white
+// background, converting CMYK, YCCK, 16-bit and transparent images. Grayscale
+// images become RGB too; ToGray keeps them gray. Like the decoders, it
+// ignores embedded color profiles: the result is taken as sRGB.
+func ToRGB(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+	return dst
+}
+
+// ToGray returns img as an opaque 8-bit grayscale image drawn over a white
+// background, such as a 16-bit grayscale image. Color images lose their
+// colors.
+func ToGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	dst := image.NewGray(bounds)
+	draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+	return dst
+}
+
+// Decode decodes the image at path.
+func Decode(path string) (image.Image, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	return image.Decode(f)
+}
+
+func exceeds(r Result, opts Options) bool {
+	return (opts.Width > 0 && r.Width > opts.Width) || (opts.Size > 0 && r.Size > opts.Size)
+}
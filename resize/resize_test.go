@@ -0,0 +1,32 @@
+package resize
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestScaleKeepsColorModel(t *testing.T) {
+	tests := []struct {
+		src  image.Image
+		want color.Model
+		name string
+	}{
+		{image.NewGray(image.Rect(0, 0, 200, 100)), color.GrayModel, "gray"},
+		{image.NewGray16(image.Rect(0, 0, 200, 100)), color.Gray16Model, "gray16"},
+		{image.NewYCbCr(image.Rect(0, 0, 200, 100), image.YCbCrSubsampleRatio420), color.RGBAModel, "rgba"},
+	}
+
+	for _, tt := range tests {
+		scaled := Scale(tt.src, 160)
+		if got := scaled.ColorModel(); got != tt.want {
+			t.Errorf("Scale of %T does not give a %s image", tt.src, tt.name)
+		}
+		if got := Crop(tt.src, 160, 50).ColorModel(); got != tt.want {
+			t.Errorf("Crop of %T does not give a %s image", tt.src, tt.name)
+		}
+		if b := scaled.Bounds(); b.Dx() != 160 || b.Dy() != 80 {
+			t.Errorf("Scale of %T = %v, want 160x80", tt.src, b)
+		}
+	}
+}
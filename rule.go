@@ -0,0 +1,506 @@
+package magicx
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/naming"
+)
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+type Severity int8
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", s)
+}
+
+// RuleID identifies a rule and the findings it reports.
+type RuleID string
+
+const (
+	RuleFolderSize         RuleID = "folder_size"
+	RuleWidth              RuleID = "width"
+	RuleImageSize          RuleID = "image_size"
+	RuleUnderImageSize     RuleID = "under_image_size"
+	RuleThumbnailSize      RuleID = "thumbnail_size"
+	RuleUnderThumbnailSize RuleID = "under_thumbnail_size"
+	RuleMismatch           RuleID = "mismatch"
+	RuleNoThumbnail        RuleID = "no_thumbnail"
+	RuleNoImage            RuleID = "no_image"
+	RuleNumbering          RuleID = "numbering"
+	RuleNaming             RuleID = "naming"
+	RuleUnreadable         RuleID = "unreadable"
+	RulePermissionDenied   RuleID = "permission_denied"
+	RuleRenameFailed       RuleID = "rename_failed"
+	RuleWriteFailed        RuleID = "write_failed"
+	RuleUnsupportedFormat  RuleID = "unsupported_format"
+	RuleFormat             RuleID = "format"
+	RuleExtension          RuleID = "extension"
+	RuleCMYK               RuleID = "cmyk"
+	RuleGrayscale          RuleID = "grayscale"
+	RuleDepth              RuleID = "depth"
+	RuleAlpha              RuleID = "alpha"
+	RuleQuality            RuleID = "quality"
+	RuleDuplicate          RuleID = "duplicate"
+	RuleSeriesDuplicate    RuleID = "series_duplicate"
+)
+
+// DefaultRules are the rules enabled for a content type which does not
+// list its own. RuleDuplicate and RuleSeriesDuplicate decode every page for
+// its perceptual hash, so a content type has to list them.
+var DefaultRules = []RuleID{
+	RuleWidth,
+	RuleImageSize,
+	RuleMismatch,
+	RuleNoThumbnail,
+	RuleNoImage,
+	RuleNumbering,
+	RuleFormat,
+	RuleExtension,
+	RuleCMYK,
+	RuleDepth,
+	RuleQuality,
+}
+
+// ErrorRules report the FileErrors of the folders. They are always enabled.
+var ErrorRules = []RuleID{
+	RuleUnreadable,
+	RulePermissionDenied,
+	RuleRenameFailed,
+	RuleWriteFailed,
+	RuleUnsupportedFormat,
+}
+
+// Rule checks a single episode folder. Rules comparing episodes, such as
+// RuleSeriesDuplicate, remember the folders they checked: a Validator builds
+// its own rules and passes them the folders of one series in order.
+type Rule interface {
+	ID() RuleID
+	Severity() Severity
+	Check(folder FolderInfo) []Finding
+}
+
+// RuleFactory builds a rule for the limits of a content type.
+type RuleFactory func(limited LimitedSizeInfo) Rule
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[RuleID]RuleFactory)
+	registered = make([]RuleID, 0)
+	titles     = make(map[RuleID][2]string)
+)
+
+// RegisterRule makes a rule available to Validate under the id. The titles
+// are the English and Japanese headings used by ConsoleLog. It panics if
+// the id is already registered.
+func RegisterRule(id RuleID, en, jp string, factory RuleFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[id]; ok {
+		panic(fmt.Sprintf("magicx: rule %q already registered", id))
+	}
+
+	registry[id] = factory
+	registered = append(registered, id)
+	titles[id] = [2]string{en, jp}
+}
+
+// RegisteredRules returns the ids of every registered rule in registration
+// order.
+func RegisteredRules() []RuleID {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return append([]RuleID(nil), registered...)
+}
+
+// Rules returns the enabled rules of the content type, in order. Unknown
+// rule ids are ignored.
+func Rules(limited LimitedSizeInfo) []Rule {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	rules := make([]Rule, 0)
+	for _, id := range limited.EnabledRules() {
+		if factory, ok := registry[id]; ok {
+			rules = append(rules, factory(limited))
+		}
+	}
+	return rules
+}
+
+// Title returns the heading used when listing episodes with this rule.
+func (id RuleID) Title(lang Language) string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	t, ok := titles[id]
+	if !ok {
+		return string(id)
+	}
+
+	if lang == JP {
+		return t[1]
+	}
+	return t[0]
+}
+
+// NewRule returns a rule calling check for each folder.
+func NewRule(id RuleID, severity Severity, check func(folder FolderInfo) []Finding) Rule {
+	return funcRule{id: id, severity: severity, check: check}
+}
+
+type funcRule struct {
+	id       RuleID
+	severity Severity
+	check    func(folder FolderInfo) []Finding
+}
+
+func (r funcRule) ID() RuleID         { return r.id }
+func (r funcRule) Severity() Severity { return r.severity }
+
+func (r funcRule) Check(folder FolderInfo) []Finding {
+	return r.check(folder)
+}
+
+func init() {
+	RegisterRule(RuleFolderSize, "Episodes over the folder size limit", "1話の容量が上限を超えていた話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleFolderSize, Warning, func(folder FolderInfo) []Finding {
+			if folder.Size > limited.Folder {
+				return []Finding{{Value: folder.Size, Limit: limited.Folder, Unit: UnitByte}}
+			}
+			return nil
+		})
+	})
+
+	RegisterRule(RuleWidth, "Episodes without a uniform page width", "1話内で横幅が統一されていない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleWidth, Error, func(folder FolderInfo) []Finding {
+			standardWidth := StandardWidth(folder)
+
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				// unreadable pages are reported by RuleUnreadable
+				if f.Width != standardWidth && f.Width != 0 {
+					findings = append(findings, Finding{File: f, Value: int64(f.Width), Limit: int64(standardWidth), Unit: UnitPixel})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleImageSize, "Episodes with pages over the size limit", "1ページの容量が上限を超えていた話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleImageSize, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				if f.Size > limited.Image.Size {
+					findings = append(findings, Finding{File: f, Value: f.Size, Limit: limited.Image.Size, Unit: UnitByte})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleUnderImageSize, "Episodes with pages under the minimum size", "1ページの容量が下限未満になっていた話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleUnderImageSize, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				if f.Size < limited.MinSize() {
+					findings = append(findings, Finding{File: f, Value: f.Size, Limit: limited.MinSize(), Unit: UnitByte})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleThumbnailSize, "Episodes with a thumbnail over the size limit", "話サムネの容量が上限を超えていた話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleThumbnailSize, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range thumbnails(folder) {
+				if f.Size > limited.Thumbnail.Size {
+					findings = append(findings, Finding{File: f, Value: f.Size, Limit: limited.Thumbnail.Size, Unit: UnitByte})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleUnderThumbnailSize, "Episodes with a thumbnail under the minimum size", "話サムネの容量が下限未満になっていた話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleUnderThumbnailSize, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range thumbnails(folder) {
+				if f.Size < limited.MinSize() {
+					findings = append(findings, Finding{File: f, Value: f.Size, Limit: limited.MinSize(), Unit: UnitByte})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleMismatch, "Episodes whose file names do not match the folder", "フォルダ名とファイル名一致していない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleMismatch, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.IsMissmatch {
+					findings = append(findings, Finding{File: f})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleNoThumbnail, "Episodes without a thumbnail", "サムネがない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleNoThumbnail, Error, func(folder FolderInfo) []Finding {
+			if HasThumbnail(folder) {
+				return nil
+			}
+			return []Finding{{}}
+		})
+	})
+
+	RegisterRule(RuleNoImage, "Episodes without images", "イメージがない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleNoImage, Error, func(folder FolderInfo) []Finding {
+			if len(pages(folder)) == 0 {
+				return []Finding{{}}
+			}
+			return nil
+		})
+	})
+
+	RegisterRule(RuleNumbering, "Episodes with non-consecutive page numbers", "ページ表記が順番になってない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleNumbering, Error, func(folder FolderInfo) []Finding {
+			pageNums := make([]int, 0, len(folder.Files))
+			for _, f := range pages(folder) {
+				pageN, _ := file.ExtractFileExtNum(f.Name, f.Ext)
+				pageNums = append(pageNums, pageN)
+			}
+
+			if !file.IsConsecutive(pageNums) {
+				return []Finding{{}}
+			}
+			return nil
+		})
+	})
+
+	RegisterRule(RuleNaming, "Episodes with page names not following the naming template", "ファイル名が命名規則に沿っていない話", func(limited LimitedSizeInfo) Rule {
+		// invalid templates are reported when the profiles are loaded
+		tmpl, err := naming.Parse(limited.NamingTemplate())
+
+		return NewRule(RuleNaming, Error, func(folder FolderInfo) []Finding {
+			if err != nil {
+				return nil
+			}
+
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				if !tmpl.Conforms(f.Name) {
+					findings = append(findings, Finding{File: f})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleFormat, "Episodes with pages in a format not allowed", "許可されていない形式の画像がある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleFormat, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.Format != "" && !limited.AllowsFormat(f.Format) {
+					findings = append(findings, Finding{File: f, Message: fmt.Sprintf("%s, allowed: %s", f.Format, strings.Join(limited.Formats, ", "))})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleExtension, "Episodes with file extensions not matching the content", "拡張子と画像形式が一致していない話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleExtension, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.Format != "" && file.ExtensionFormat(f.Ext) != f.Format {
+					findings = append(findings, Finding{File: f, Message: fmt.Sprintf("%s content in a %s file", f.Format, f.Ext)})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleCMYK, "Episodes with CMYK or YCCK pages", "CMYK・YCCKの画像がある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleCMYK, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.Color == file.ColorCMYK || f.Color == file.ColorYCCK {
+					findings = append(findings, Finding{File: f, Message: f.ColorMode()})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleGrayscale, "Episodes mixing grayscale and color pages", "グレースケールとカラーの画像が混在している話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleGrayscale, Warning, func(folder FolderInfo) []Finding {
+			gray := StandardGray(folder)
+
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				if f.Color != "" && (f.Color == file.ColorGray) != gray {
+					findings = append(findings, Finding{File: f, Message: f.ColorMode()})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleDepth, "Episodes with pages over 8 bits per channel", "1チャンネル8bitを超える画像がある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleDepth, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.Depth > 8 {
+					findings = append(findings, Finding{File: f, Message: f.ColorMode()})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleAlpha, "Episodes with pages having an alpha channel", "アルファチャンネルを含む画像がある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleAlpha, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, f := range folder.Files {
+				if f.Alpha {
+					findings = append(findings, Finding{File: f, Message: f.ColorMode()})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleQuality, "Episodes with pages under the minimum JPEG quality", "JPEG画質が最低値を下回る画像がある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleQuality, Warning, func(folder FolderInfo) []Finding {
+			if limited.Image.Quality == 0 {
+				return nil
+			}
+
+			findings := make([]Finding, 0)
+			for _, f := range pages(folder) {
+				// the quality of other formats and unparsed tables is 0
+				if f.Quality > 0 && f.Quality < limited.Image.Quality {
+					findings = append(findings, Finding{File: f, Value: int64(f.Quality), Limit: int64(limited.Image.Quality), Unit: UnitQuality})
+				}
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleDuplicate, "Episodes with duplicated pages", "同じ画像のページがある話", func(limited LimitedSizeInfo) Rule {
+		return NewRule(RuleDuplicate, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+
+			earlier := make([]FileInfo, 0, len(folder.Files))
+			for _, f := range hashedPages(folder) {
+				if original, similarity, ok := duplicateOf(f, earlier, limited.MinSimilarity()); ok {
+					findings = append(findings, Finding{File: f, Value: int64(similarity), Limit: int64(limited.MinSimilarity()), Unit: UnitPercent, Message: "same as " + original.Name})
+				}
+				earlier = append(earlier, f)
+			}
+			return findings
+		})
+	})
+
+	RegisterRule(RuleSeriesDuplicate, "Episodes with pages duplicated from an earlier episode", "前の話と同じ画像のページがある話", func(limited LimitedSizeInfo) Rule {
+		// the pages of the folders already checked, in the order Check and
+		// Validate pass them
+		earlier := make([]FileInfo, 0)
+
+		return NewRule(RuleSeriesDuplicate, Warning, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+
+			hashed := hashedPages(folder)
+			for _, f := range hashed {
+				if original, similarity, ok := duplicateOf(f, earlier, limited.MinSimilarity()); ok {
+					findings = append(findings, Finding{File: f, Value: int64(similarity), Limit: int64(limited.MinSimilarity()), Unit: UnitPercent, Message: "same as " + original.Folder + "/" + original.Name})
+				}
+			}
+			earlier = append(earlier, hashed...)
+			return findings
+		})
+	})
+
+	RegisterRule(RuleUnreadable, "Episodes with unreadable files", "読み込めないファイルがある話", errorRule(RuleUnreadable))
+	RegisterRule(RulePermissionDenied, "Episodes with files denied access", "アクセス権限がないファイルがある話", errorRule(RulePermissionDenied))
+	RegisterRule(RuleRenameFailed, "Episodes with files which could not be renamed", "ファイル名の変更に失敗した話", errorRule(RuleRenameFailed))
+	RegisterRule(RuleWriteFailed, "Episodes with files which could not be written", "ファイルの書き込みに失敗した話", errorRule(RuleWriteFailed))
+	RegisterRule(RuleUnsupportedFormat, "Episodes with images in an unsupported format", "対応していない形式の画像がある話", errorRule(RuleUnsupportedFormat))
+}
+
+// errorRule returns a factory of the rule reporting the folder errors of the
+// id.
+func errorRule(id RuleID) RuleFactory {
+	return func(limited LimitedSizeInfo) Rule {
+		return NewRule(id, Error, func(folder FolderInfo) []Finding {
+			findings := make([]Finding, 0)
+			for _, e := range folder.Errors {
+				if e.Rule() == id {
+					findings = append(findings, Finding{File: e.File, Message: e.Err.Error()})
+				}
+			}
+			return findings
+		})
+	}
+}
+
+func pages(folder FolderInfo) []FileInfo {
+	files := make([]FileInfo, 0, len(folder.Files))
+	for _, f := range folder.Files {
+		if !f.IsThumbnail {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// hashedPages returns the pages of the folder having a perceptual hash. Blank
+// pages are left out, as they all look the same.
+func hashedPages(folder FolderInfo) []FileInfo {
+	files := make([]FileInfo, 0, len(folder.Files))
+	for _, f := range pages(folder) {
+		if f.Hashed && !f.Blank {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// duplicateOf returns the page of pages most similar to f, when at least
+// minSimilarity percent similar.
+func duplicateOf(f FileInfo, pages []FileInfo, minSimilarity int) (FileInfo, int, bool) {
+	best, bestSimilarity := FileInfo{}, -1
+	for _, p := range pages {
+		if similarity := file.Similarity(f.PHash, p.PHash); similarity > bestSimilarity {
+			best, bestSimilarity = p, similarity
+		}
+	}
+	return best, bestSimilarity, bestSimilarity >= minSimilarity
+}
+
+func thumbnails(folder FolderInfo) []FileInfo {
+	files := make([]FileInfo, 0)
+	for _, f := range folder.Files {
+		if f.IsThumbnail {
+			files = append(files, f)
+		}
+	}
+	return files
+}
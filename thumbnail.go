@@ -0,0 +1,160 @@
+package magicx
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/xingbase/magicx/file"
+	"github.com/xingbase/magicx/journal"
+	"github.com/xingbase/magicx/resize"
+)
+
+var folderNumRe = regexp.MustCompile(`\d+`)
+
+type ThumbnailOptions struct {
+	Page   int // page number used as the source, first page when 0
+	Height int // crop height in pixels, aspect ratio kept when 0
+}
+
+// ThumbnailName returns the thumbnail file name of the episode folder. The
+// episode number keeps the zero-padding of the folder name so that
+// file.ExtractFolderNum returns the same number for both.
+func ThumbnailName(folder string) (string, error) {
+	num := folderNumRe.FindString(folder)
+	if num == "" {
+		return "", fmt.Errorf("no number found in folder name %s", folder)
+	}
+	return "tmb_" + num + ".jpg", nil
+}
+
+// HasThumbnail reports whether the folder has a thumbnail numbered after
+// the episode.
+func HasThumbnail(folder FolderInfo) bool {
+	n, _ := file.ExtractFolderNum(folder.Name)
+	for _, f := range thumbnails(folder) {
+		if thumbN, _ := file.ExtractFolderNum(f.Name); thumbN == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Thumbnail generates the thumbnail of the episode folder from one of its
+// pages, scaled to the thumbnail width and compressed under the thumbnail
+// size of the content type.
+func Thumbnail(folder FolderInfo, limited LimitedSizeInfo, opts ThumbnailOptions, j *journal.Journal) (FileInfo, error) {
+	name, err := ThumbnailName(folder.Name)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	src, err := thumbnailSource(folder, opts.Page)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	img, _, err := resize.Decode(src.FullName())
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	img = resize.Crop(img, limited.Thumbnail.Width, opts.Height)
+
+	data, result, err := resize.Reduce(img, "jpeg", resize.Options{Size: limited.Thumbnail.Size, Quality: src.Quality})
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	thumb := FileInfo{
+		Path:        src.Path,
+		Folder:      src.Folder,
+		Name:        name,
+		Ext:         ".jpg",
+		Size:        result.Size,
+		Width:       result.Width,
+		Height:      result.Height,
+		Format:      result.Format,
+		Color:       file.ColorRGB,
+		Depth:       8,
+		Quality:     result.Quality,
+		IsStandard:  true,
+		IsThumbnail: true,
+	}
+
+	if err := j.Create(thumb.FullName(), data, 0644); err != nil {
+		return FileInfo{}, err
+	}
+
+	return thumb, nil
+}
+
+// Thumbnails generates a thumbnail for every episode folder lacking one and
+// adds it to the folder files. It stops when ctx is cancelled.
+func Thumbnails(ctx context.Context, in <-chan FolderInfo, limited LimitedSizeInfo, opts ThumbnailOptions, j *journal.Journal, progress ProgressFunc) <-chan FolderInfo {
+	out := make(chan FolderInfo)
+
+	go func() {
+		defer close(out)
+
+		done := 0
+		for folderInfo := range in {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if n, _ := file.ExtractFolderNum(folderInfo.Name); n != 0 && !HasThumbnail(folderInfo) {
+				thumb, err := Thumbnail(folderInfo, limited, opts, j)
+				if err != nil {
+					thumb := FileInfo{Folder: folderInfo.Name}
+					thumb.Name, _ = ThumbnailName(folderInfo.Name)
+					if len(folderInfo.Files) > 0 {
+						thumb.Path = folderInfo.Files[0].Path
+					}
+					folderInfo.Errors = append(folderInfo.Errors, FileError{File: thumb, Op: OpWrite, Err: err})
+				} else {
+					folderInfo.Files = append(folderInfo.Files, thumb)
+					folderInfo.Size += thumb.Size
+				}
+			}
+
+			done += len(folderInfo.Files)
+			progress.report(Progress{Stage: StageThumbnail, Done: done, Episode: folderInfo.Name})
+
+			select {
+			case out <- folderInfo:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// thumbnailSource returns the page numbered n, or the first page when n is 0.
+func thumbnailSource(folder FolderInfo, n int) (FileInfo, error) {
+	files := pages(folder)
+	if len(files) == 0 {
+		return FileInfo{}, fmt.Errorf("no image found in folder %s", folder.Name)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, _ := file.ExtractFileExtNum(files[i].Name, files[i].Ext)
+		b, _ := file.ExtractFileExtNum(files[j].Name, files[j].Ext)
+		return a < b
+	})
+
+	if n == 0 {
+		return files[0], nil
+	}
+
+	for _, f := range files {
+		if pageN, _ := file.ExtractFileExtNum(f.Name, f.Ext); pageN == n {
+			return f, nil
+		}
+	}
+
+	return FileInfo{}, fmt.Errorf("page %d not found in folder %s", n, folder.Name)
+}
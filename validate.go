@@ -0,0 +1,285 @@
+package magicx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xingbase/magicx/file"
+)
+
+const (
+	UnitPixel   Unit = "px"
+	UnitByte    Unit = "B"
+	UnitQuality Unit = "quality"
+	UnitPercent Unit = "%"
+)
+
+// Unit is the unit of the measured value and limit of a Finding.
+type Unit string
+
+// Finding is a single problem found in an episode. File is empty for
+// findings about the episode as a whole.
+type Finding struct {
+	Rule     RuleID
+	Severity Severity
+	File     FileInfo
+	Value    int64
+	Limit    int64
+	Unit     Unit
+	Message  string // description of the findings without a measure
+}
+
+// Describe returns the measured value against the limit, e.g.
+// "1598px vs 1600px", "21.3 MB vs 20.0 MB" or "quality 40 vs 70", followed
+// by the message of the finding if any.
+func (f Finding) Describe() string {
+	var measure string
+	switch f.Unit {
+	case UnitPixel:
+		measure = fmt.Sprintf("%dpx vs %dpx", f.Value, f.Limit)
+	case UnitByte:
+		measure = fmt.Sprintf("%s vs %s", file.FormatSize(f.Value), file.FormatSize(f.Limit))
+	case UnitQuality:
+		measure = fmt.Sprintf("quality %d vs %d", f.Value, f.Limit)
+	case UnitPercent:
+		measure = fmt.Sprintf("%d%% vs %d%%", f.Value, f.Limit)
+	}
+
+	switch {
+	case measure == "":
+		return f.Message
+	case f.Message == "":
+		return measure
+	}
+	return measure + ", " + f.Message
+}
+
+type EpisodeReport struct {
+	Number   int
+	Folder   FolderInfo
+	Findings []Finding
+}
+
+// Name returns the display name of the episode.
+func (e EpisodeReport) Name(lang Language) string {
+	return EpisodeName(e.Number, lang)
+}
+
+// Has reports whether the episode has at least one finding of the rule.
+func (e EpisodeReport) Has(id RuleID) bool {
+	for _, f := range e.Findings {
+		if f.Rule == id {
+			return true
+		}
+	}
+	return false
+}
+
+type Report struct {
+	Episodes []EpisodeReport
+}
+
+// With returns the episodes having at least one finding of the rule.
+func (r Report) With(id RuleID) []EpisodeReport {
+	episodes := make([]EpisodeReport, 0)
+	for _, e := range r.Episodes {
+		if e.Has(id) {
+			episodes = append(episodes, e)
+		}
+	}
+	return episodes
+}
+
+// HasFindings reports whether any episode has a finding of the given rules.
+func (r Report) HasFindings(ids ...RuleID) bool {
+	for _, id := range ids {
+		if len(r.With(id)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the report of an episode, keeping the episodes sorted by number.
+func (r *Report) Add(e EpisodeReport) {
+	i := sort.Search(len(r.Episodes), func(i int) bool {
+		return r.Episodes[i].Number > e.Number
+	})
+
+	r.Episodes = append(r.Episodes, EpisodeReport{})
+	copy(r.Episodes[i+1:], r.Episodes[i:])
+	r.Episodes[i] = e
+}
+
+// Validate runs the enabled rules of the content type on the episode
+// folders, in episode order. Folders without an episode number are skipped.
+func Validate(folders []FolderInfo, limited LimitedSizeInfo) Report {
+	v := NewValidator(limited)
+
+	ordered := append([]FolderInfo(nil), folders...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return EpisodeLess(ordered[i].Name, ordered[j].Name)
+	})
+
+	report := Report{Episodes: make([]EpisodeReport, 0, len(folders))}
+	for _, folder := range ordered {
+		if episode, ok := v.Validate(folder); ok {
+			report.Add(episode)
+		}
+	}
+
+	return report
+}
+
+// Validator runs the enabled rules of a content type on the episode folders
+// of one series, passed one at a time in episode order as Load sends them,
+// so rules comparing episodes see the earlier ones.
+type Validator struct {
+	rules []Rule
+}
+
+// NewValidator returns a validator of a series of the content type.
+func NewValidator(limited LimitedSizeInfo) *Validator {
+	return &Validator{rules: Rules(limited)}
+}
+
+// Validate runs the rules on the episode folder. It returns false for
+// folders without an episode number.
+func (v *Validator) Validate(folder FolderInfo) (EpisodeReport, bool) {
+	n, _ := file.ExtractFolderNum(folder.Name)
+	if n == 0 {
+		return EpisodeReport{}, false
+	}
+
+	episode := EpisodeReport{
+		Number:   n,
+		Folder:   folder,
+		Findings: make([]Finding, 0),
+	}
+
+	for _, rule := range v.rules {
+		for _, finding := range rule.Check(folder) {
+			finding.Rule = rule.ID()
+			finding.Severity = rule.Severity()
+			episode.Findings = append(episode.Findings, finding)
+		}
+	}
+
+	return episode, true
+}
+
+// Check is the validation stage of the pipeline, sending the report of each
+// episode as soon as its folder arrives:
+//
+//	report := Report{}
+//	loaded, err := Load(ctx, dir, LoadOptions{}, nil)
+//	if err != nil {
+//		return err
+//	}
+//	for episode := range Check(ctx, Reanme(ctx, loaded, 3, nil, nil), limited, nil) {
+//		report.Add(episode)
+//	}
+//
+// When ctx is cancelled the stages stop sending, so the loop ends early;
+// ctx.Err() tells both cases apart.
+func Check(ctx context.Context, in <-chan FolderInfo, limited LimitedSizeInfo, progress ProgressFunc) <-chan EpisodeReport {
+	out := make(chan EpisodeReport)
+
+	go func() {
+		defer close(out)
+
+		v := NewValidator(limited)
+
+		done := 0
+		for folderInfo := range in {
+			if ctx.Err() != nil {
+				return
+			}
+
+			done += len(folderInfo.Files)
+			progress.report(Progress{Stage: StageCheck, Done: done, Episode: folderInfo.Name})
+
+			episode, ok := v.Validate(folderInfo)
+			if !ok {
+				continue
+			}
+
+			select {
+			case out <- episode:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// StandardWidth returns the most common page width of the folder, ignoring
+// thumbnails and unreadable pages. Ties are resolved in favour of the first
+// page.
+func StandardWidth(folder FolderInfo) int {
+	widthCounts := make(map[int]int)
+	maxCount := 0
+	standardWidth := 0
+
+	for _, f := range folder.Files {
+		if f.IsThumbnail || f.Width == 0 {
+			continue
+		}
+
+		widthCounts[f.Width]++
+		if widthCounts[f.Width] > maxCount {
+			maxCount = widthCounts[f.Width]
+			standardWidth = f.Width
+		}
+	}
+
+	return standardWidth
+}
+
+// StandardGray reports whether most pages of the folder are grayscale,
+// ignoring thumbnails and unreadable pages. Ties are resolved in favour of
+// color.
+func StandardGray(folder FolderInfo) bool {
+	gray, color := 0, 0
+	for _, f := range folder.Files {
+		if f.IsThumbnail || f.Color == "" {
+			continue
+		}
+
+		if f.Color == file.ColorGray {
+			gray++
+		} else {
+			color++
+		}
+	}
+
+	return gray > color
+}
+
+// ConsoleLog lists the episodes of the report for each rule, one section
+// per rule having at least one episode.
+func ConsoleLog(report Report, lang Language, ids ...RuleID) string {
+	var results strings.Builder
+
+	for _, id := range ids {
+		episodes := report.With(id)
+		if len(episodes) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(episodes))
+		for _, e := range episodes {
+			names = append(names, e.Name(lang))
+		}
+
+		results.WriteString(fmt.Sprintf("\n# %s\n", id.Title(lang)))
+		results.WriteString(strings.Join(names, ", "))
+		results.WriteString("\n")
+	}
+
+	return results.String()
+}
@@ -0,0 +1,79 @@
+package magicx
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xingbase/magicx/file"
+)
+
+func testPage(name string, width int, size int64) FileInfo {
+	return FileInfo{Name: name, Ext: filepath.Ext(name), Size: size, Width: width, Height: 1000, Format: "jpeg", Color: file.ColorRGB, Depth: 8}
+}
+
+func testEpisode(name string, files ...FileInfo) FolderInfo {
+	folder := FolderInfo{Name: name, Files: files}
+	for _, f := range files {
+		folder.Size += f.Size
+	}
+	return folder
+}
+
+func TestValidateRules(t *testing.T) {
+	limited := LimitedSizeInfo{
+		Image:     ImageSize{Width: 690, Size: 1 << 20},
+		Thumbnail: ThumbnailSize{Width: 500, Size: 50 << 10},
+		Folder:    60 << 20,
+	}
+	thumbnail := FileInfo{Name: "tmb_0001.jpg", Ext: ".jpg", Size: 20 << 10, Width: 500, Format: "jpeg", Color: file.ColorRGB, Depth: 8, IsThumbnail: true}
+	mismatch := testPage("abc_0002_003.jpg", 690, 100<<10)
+	mismatch.IsMissmatch = true
+
+	tests := []struct {
+		name   string
+		folder FolderInfo
+		want   []RuleID
+	}{
+		{"ok", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 100<<10), thumbnail), nil},
+		{"width", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 100<<10), testPage("abc_0001_003.jpg", 720, 100<<10), thumbnail), []RuleID{RuleWidth}},
+		{"size", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 2<<20), thumbnail), []RuleID{RuleImageSize}},
+		{"no thumbnail", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 100<<10)), []RuleID{RuleNoThumbnail}},
+		{"numbering", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 100<<10), testPage("abc_0001_004.jpg", 690, 100<<10), thumbnail), []RuleID{RuleNumbering}},
+		{"mismatch", testEpisode("0001", testPage("abc_0001_001.jpg", 690, 100<<10), testPage("abc_0001_002.jpg", 690, 100<<10), mismatch, thumbnail), []RuleID{RuleMismatch}},
+	}
+
+	for _, tt := range tests {
+		report := Validate([]FolderInfo{tt.folder}, limited)
+		if len(report.Episodes) != 1 {
+			t.Errorf("%s: got %d episodes, want 1", tt.name, len(report.Episodes))
+			continue
+		}
+
+		var got []RuleID
+		for _, f := range report.Episodes[0].Findings {
+			got = append(got, f.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: findings of %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEpisodes(t *testing.T) {
+	folders := []FolderInfo{
+		testEpisode("10", testPage("abc_0010_001.jpg", 690, 100<<10)),
+		testEpisode("extra", testPage("cover.jpg", 690, 100<<10)),
+		testEpisode("2", testPage("abc_0002_001.jpg", 690, 100<<10)),
+	}
+
+	report := Validate(folders, LimitedSizeInfoByContentType["comic"])
+
+	var got []int
+	for _, e := range report.Episodes {
+		got = append(got, e.Number)
+	}
+	if want := []int{2, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("episodes %v, want %v", got, want)
+	}
+}